@@ -50,6 +50,7 @@ func loadNewConfig() Config {
 	}
 }
 
+//ExampleAtomicValue 读者不在 cond.Wait 中时发生的更新会被错过，带版本号的做法见 biz/config
 func ExampleAtomicValue()  {
 	var config atomic.Value
 	config.Store(loadNewConfig())
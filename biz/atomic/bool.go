@@ -0,0 +1,76 @@
+package atomic
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+)
+
+//Bool 原子的 bool
+type Bool struct {
+	_ noCopy
+	v uint32
+}
+
+//NewBool 创建初始值为 v 的 Bool
+func NewBool(v bool) *Bool {
+	b := &Bool{}
+	b.Store(v)
+	return b
+}
+
+func boolToInt(v bool) uint32 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+//Load 原子读取
+func (b *Bool) Load() bool {
+	return atomic.LoadUint32(&b.v) == 1
+}
+
+//Store 原子写入
+func (b *Bool) Store(v bool) {
+	atomic.StoreUint32(&b.v, boolToInt(v))
+}
+
+//Swap 写入新值，返回旧值
+func (b *Bool) Swap(v bool) bool {
+	return atomic.SwapUint32(&b.v, boolToInt(v)) == 1
+}
+
+//CompareAndSwap 当前值是 old 时替换为 new
+func (b *Bool) CompareAndSwap(old, new bool) bool {
+	return atomic.CompareAndSwapUint32(&b.v, boolToInt(old), boolToInt(new))
+}
+
+//Toggle 取反，返回旧值
+func (b *Bool) Toggle() bool {
+	for {
+		old := b.Load()
+		if b.CompareAndSwap(old, !old) {
+			return old
+		}
+	}
+}
+
+func (b *Bool) String() string {
+	return strconv.FormatBool(b.Load())
+}
+
+//MarshalJSON 实现 json.Marshaler
+func (b *Bool) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.Load())
+}
+
+//UnmarshalJSON 实现 json.Unmarshaler
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	var v bool
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	b.Store(v)
+	return nil
+}
@@ -0,0 +1,77 @@
+package atomic
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+//Duration 原子的 time.Duration
+type Duration struct {
+	_ noCopy
+	v int64
+}
+
+//NewDuration 创建初始值为 v 的 Duration
+func NewDuration(v time.Duration) *Duration {
+	return &Duration{v: int64(v)}
+}
+
+//Load 原子读取
+func (d *Duration) Load() time.Duration {
+	return time.Duration(atomic.LoadInt64(&d.v))
+}
+
+//Store 原子写入
+func (d *Duration) Store(v time.Duration) {
+	atomic.StoreInt64(&d.v, int64(v))
+}
+
+//Swap 写入新值，返回旧值
+func (d *Duration) Swap(v time.Duration) time.Duration {
+	return time.Duration(atomic.SwapInt64(&d.v, int64(v)))
+}
+
+//CompareAndSwap 当前值是 old 时替换为 new
+func (d *Duration) CompareAndSwap(old, new time.Duration) bool {
+	return atomic.CompareAndSwapInt64(&d.v, int64(old), int64(new))
+}
+
+//Add 加上 delta，返回新值
+func (d *Duration) Add(delta time.Duration) time.Duration {
+	return time.Duration(atomic.AddInt64(&d.v, int64(delta)))
+}
+
+//Sub 减去 delta，返回新值
+func (d *Duration) Sub(delta time.Duration) time.Duration {
+	return time.Duration(atomic.AddInt64(&d.v, -int64(delta)))
+}
+
+func (d *Duration) String() string {
+	return d.Load().String()
+}
+
+//MarshalJSON 实现 json.Marshaler，输出 "1m30s" 这样的字符串
+func (d *Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Load().String())
+}
+
+//UnmarshalJSON 实现 json.Unmarshaler，接受 "1m30s" 这样的字符串或者纳秒数
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		d.Store(v)
+		return nil
+	}
+	var ns int64
+	if err := json.Unmarshal(data, &ns); err != nil {
+		return fmt.Errorf("atomic: cannot unmarshal %s into Duration", data)
+	}
+	d.Store(time.Duration(ns))
+	return nil
+}
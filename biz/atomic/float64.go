@@ -0,0 +1,74 @@
+package atomic
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"sync/atomic"
+)
+
+//Float64 原子的 float64，按 math.Float64bits 保存
+type Float64 struct {
+	_ noCopy
+	v uint64
+}
+
+//NewFloat64 创建初始值为 v 的 Float64
+func NewFloat64(v float64) *Float64 {
+	return &Float64{v: math.Float64bits(v)}
+}
+
+//Load 原子读取
+func (f *Float64) Load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.v))
+}
+
+//Store 原子写入
+func (f *Float64) Store(v float64) {
+	atomic.StoreUint64(&f.v, math.Float64bits(v))
+}
+
+//Swap 写入新值，返回旧值
+func (f *Float64) Swap(v float64) float64 {
+	return math.Float64frombits(atomic.SwapUint64(&f.v, math.Float64bits(v)))
+}
+
+//CompareAndSwap 当前值是 old 时替换为 new，按位比较：NaN 可以匹配相同的 NaN，0 和 -0 不相等
+func (f *Float64) CompareAndSwap(old, new float64) bool {
+	return atomic.CompareAndSwapUint64(&f.v, math.Float64bits(old), math.Float64bits(new))
+}
+
+//Add 加上 delta，返回新值
+func (f *Float64) Add(delta float64) float64 {
+	for {
+		old := atomic.LoadUint64(&f.v)
+		v := math.Float64frombits(old) + delta
+		if atomic.CompareAndSwapUint64(&f.v, old, math.Float64bits(v)) {
+			return v
+		}
+	}
+}
+
+//Sub 减去 delta，返回新值
+func (f *Float64) Sub(delta float64) float64 {
+	return f.Add(-delta)
+}
+
+func (f *Float64) String() string {
+	return strconv.FormatFloat(f.Load(), 'g', -1, 64)
+}
+
+//MarshalJSON 实现 json.Marshaler
+func (f *Float64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Load())
+}
+
+//UnmarshalJSON 实现 json.Unmarshaler
+func (f *Float64) UnmarshalJSON(data []byte) error {
+	var v float64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	f.Store(v)
+	return nil
+}
@@ -0,0 +1,288 @@
+package atomic
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+)
+
+//Int32 原子的 int32
+type Int32 struct {
+	_ noCopy
+	v int32
+}
+
+//NewInt32 创建初始值为 v 的 Int32
+func NewInt32(v int32) *Int32 {
+	return &Int32{v: v}
+}
+
+//Load 原子读取
+func (i *Int32) Load() int32 {
+	return atomic.LoadInt32(&i.v)
+}
+
+//Store 原子写入
+func (i *Int32) Store(v int32) {
+	atomic.StoreInt32(&i.v, v)
+}
+
+//Swap 写入新值，返回旧值
+func (i *Int32) Swap(v int32) int32 {
+	return atomic.SwapInt32(&i.v, v)
+}
+
+//CompareAndSwap 当前值是 old 时替换为 new
+func (i *Int32) CompareAndSwap(old, new int32) bool {
+	return atomic.CompareAndSwapInt32(&i.v, old, new)
+}
+
+//Add 加上 delta，返回新值
+func (i *Int32) Add(delta int32) int32 {
+	return atomic.AddInt32(&i.v, delta)
+}
+
+//Sub 减去 delta，返回新值
+func (i *Int32) Sub(delta int32) int32 {
+	return atomic.AddInt32(&i.v, -delta)
+}
+
+//Inc 加一，返回新值
+func (i *Int32) Inc() int32 {
+	return i.Add(1)
+}
+
+//Dec 减一，返回新值
+func (i *Int32) Dec() int32 {
+	return i.Sub(1)
+}
+
+func (i *Int32) String() string {
+	return strconv.FormatInt(int64(i.Load()), 10)
+}
+
+//MarshalJSON 实现 json.Marshaler
+func (i *Int32) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.Load())
+}
+
+//UnmarshalJSON 实现 json.Unmarshaler
+func (i *Int32) UnmarshalJSON(data []byte) error {
+	var v int32
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	i.Store(v)
+	return nil
+}
+
+//Int64 原子的 int64。noCopy 不占空间，放在最前面时 v 的偏移还是 0，在 32 位平台上也是 8 字节对齐的；
+//放在最后的话，结尾的零大小字段会让结构体多出 8 字节的填充
+type Int64 struct {
+	_ noCopy
+	v int64
+}
+
+//NewInt64 创建初始值为 v 的 Int64
+func NewInt64(v int64) *Int64 {
+	return &Int64{v: v}
+}
+
+//Load 原子读取
+func (i *Int64) Load() int64 {
+	return atomic.LoadInt64(&i.v)
+}
+
+//Store 原子写入
+func (i *Int64) Store(v int64) {
+	atomic.StoreInt64(&i.v, v)
+}
+
+//Swap 写入新值，返回旧值
+func (i *Int64) Swap(v int64) int64 {
+	return atomic.SwapInt64(&i.v, v)
+}
+
+//CompareAndSwap 当前值是 old 时替换为 new
+func (i *Int64) CompareAndSwap(old, new int64) bool {
+	return atomic.CompareAndSwapInt64(&i.v, old, new)
+}
+
+//Add 加上 delta，返回新值
+func (i *Int64) Add(delta int64) int64 {
+	return atomic.AddInt64(&i.v, delta)
+}
+
+//Sub 减去 delta，返回新值
+func (i *Int64) Sub(delta int64) int64 {
+	return atomic.AddInt64(&i.v, -delta)
+}
+
+//Inc 加一，返回新值
+func (i *Int64) Inc() int64 {
+	return i.Add(1)
+}
+
+//Dec 减一，返回新值
+func (i *Int64) Dec() int64 {
+	return i.Sub(1)
+}
+
+func (i *Int64) String() string {
+	return strconv.FormatInt(i.Load(), 10)
+}
+
+//MarshalJSON 实现 json.Marshaler
+func (i *Int64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.Load())
+}
+
+//UnmarshalJSON 实现 json.Unmarshaler
+func (i *Int64) UnmarshalJSON(data []byte) error {
+	var v int64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	i.Store(v)
+	return nil
+}
+
+//Uint32 原子的 uint32
+type Uint32 struct {
+	_ noCopy
+	v uint32
+}
+
+//NewUint32 创建初始值为 v 的 Uint32
+func NewUint32(v uint32) *Uint32 {
+	return &Uint32{v: v}
+}
+
+//Load 原子读取
+func (i *Uint32) Load() uint32 {
+	return atomic.LoadUint32(&i.v)
+}
+
+//Store 原子写入
+func (i *Uint32) Store(v uint32) {
+	atomic.StoreUint32(&i.v, v)
+}
+
+//Swap 写入新值，返回旧值
+func (i *Uint32) Swap(v uint32) uint32 {
+	return atomic.SwapUint32(&i.v, v)
+}
+
+//CompareAndSwap 当前值是 old 时替换为 new
+func (i *Uint32) CompareAndSwap(old, new uint32) bool {
+	return atomic.CompareAndSwapUint32(&i.v, old, new)
+}
+
+//Add 加上 delta，返回新值
+func (i *Uint32) Add(delta uint32) uint32 {
+	return atomic.AddUint32(&i.v, delta)
+}
+
+//Sub 减去 delta，返回新值
+func (i *Uint32) Sub(delta uint32) uint32 {
+	return atomic.AddUint32(&i.v, ^(delta - 1))
+}
+
+//Inc 加一，返回新值
+func (i *Uint32) Inc() uint32 {
+	return i.Add(1)
+}
+
+//Dec 减一，返回新值
+func (i *Uint32) Dec() uint32 {
+	return i.Sub(1)
+}
+
+func (i *Uint32) String() string {
+	return strconv.FormatUint(uint64(i.Load()), 10)
+}
+
+//MarshalJSON 实现 json.Marshaler
+func (i *Uint32) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.Load())
+}
+
+//UnmarshalJSON 实现 json.Unmarshaler
+func (i *Uint32) UnmarshalJSON(data []byte) error {
+	var v uint32
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	i.Store(v)
+	return nil
+}
+
+//Uint64 原子的 uint64，noCopy 放在最前面的原因见 Int64
+type Uint64 struct {
+	_ noCopy
+	v uint64
+}
+
+//NewUint64 创建初始值为 v 的 Uint64
+func NewUint64(v uint64) *Uint64 {
+	return &Uint64{v: v}
+}
+
+//Load 原子读取
+func (i *Uint64) Load() uint64 {
+	return atomic.LoadUint64(&i.v)
+}
+
+//Store 原子写入
+func (i *Uint64) Store(v uint64) {
+	atomic.StoreUint64(&i.v, v)
+}
+
+//Swap 写入新值，返回旧值
+func (i *Uint64) Swap(v uint64) uint64 {
+	return atomic.SwapUint64(&i.v, v)
+}
+
+//CompareAndSwap 当前值是 old 时替换为 new
+func (i *Uint64) CompareAndSwap(old, new uint64) bool {
+	return atomic.CompareAndSwapUint64(&i.v, old, new)
+}
+
+//Add 加上 delta，返回新值
+func (i *Uint64) Add(delta uint64) uint64 {
+	return atomic.AddUint64(&i.v, delta)
+}
+
+//Sub 减去 delta，返回新值
+func (i *Uint64) Sub(delta uint64) uint64 {
+	return atomic.AddUint64(&i.v, ^(delta - 1))
+}
+
+//Inc 加一，返回新值
+func (i *Uint64) Inc() uint64 {
+	return i.Add(1)
+}
+
+//Dec 减一，返回新值
+func (i *Uint64) Dec() uint64 {
+	return i.Sub(1)
+}
+
+func (i *Uint64) String() string {
+	return strconv.FormatUint(i.Load(), 10)
+}
+
+//MarshalJSON 实现 json.Marshaler
+func (i *Uint64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.Load())
+}
+
+//UnmarshalJSON 实现 json.Unmarshaler
+func (i *Uint64) UnmarshalJSON(data []byte) error {
+	var v uint64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	i.Store(v)
+	return nil
+}
@@ -12,16 +12,23 @@ import (
 	出队的时候移除一个节点，并通过 CAS 操作移动 head 指针，同时在必要的时候移动尾指针。
  */
 
-//lock-free 的 queue
+//Dequeue 原来把 q.tail 读成了 head：队列不空、尾指针移动之后 head 永远不等于 q.head，Dequeue 会一直自旋；
+//Enqueue 原来的 else 跟在 "尾还是尾" 的判断后面，别的 goroutine 加了节点但还没移动尾指针时只能干等，不是 lock-free 的。
+//两处都按 Michael-Scott 的论文改正了。
+
+//lock-free 的 queue，零值不能使用，需要通过 NewLKQueue 创建
 type LKQueue struct {
 	head unsafe.Pointer
 	tail unsafe.Pointer
+
+	//len 近似的元素个数：入队、出队成功之后才修改计数，并发时和真实的个数可能有短暂的差别
+	len Int64
 }
 
 //通过链表实现，这个数据结构代表链表中的节点
 type node struct {
 	value interface{}
-	next unsafe.Pointer
+	next  unsafe.Pointer
 }
 
 //创建新的链接
@@ -34,26 +41,27 @@ func NewLKQueue() *LKQueue {
 //入队
 func (q *LKQueue) Enqueue(v interface{}) {
 	n := &node{value: v}
-	for  {
+	for {
 		tail := load(&q.tail)
 		next := load(&tail.next)
 		if tail == load(&q.tail) { //尾还是尾
 			if next == nil { //还没有新数据入队
 				if cas(&tail.next, next, n) { //增加到队尾
 					cas(&q.tail, tail, n) //入队成功，移动尾巴指针
+					q.len.Inc()
 					return
 				}
+			} else { //已有新数据加到队列后面，需要移动尾指针
+				cas(&q.tail, tail, next)
 			}
-		}else { //已有新数据加到队列后面，需要移动尾指针
-			cas(&q.tail, tail, next)
 		}
 	}
 }
 
 //出队，没有元素则返回nil
 func (q *LKQueue) Dequeue() interface{} {
-	for  {
-		head := load(&q.tail)
+	for {
+		head := load(&q.head)
 		tail := load(&q.tail)
 		next := load(&head.next)
 		if head == load(&q.head) { //head还是那个head
@@ -63,11 +71,14 @@ func (q *LKQueue) Dequeue() interface{} {
 				}
 				//只是尾指针还没有调整，尝试调整它指向下一个
 				cas(&q.tail, tail, next)
-			}else {
-				//读取出队的数据
-				v := next.value
+			} else {
 				// 既然要出队了，头指针移动到下一个
 				if cas(&q.head, head, next) {
+					//next 成了新的辅助头节点，取出数据后清掉引用，否则它会一直被队列引用到下一次出队
+					//数据在 CAS 成功之后才读：只有赢得 CAS 的 goroutine 会读写 next.value，不和失败重试的 goroutine 竞争
+					v := next.value
+					next.value = nil
+					q.len.Dec()
 					return v // dequeue is done. return
 				}
 			}
@@ -75,6 +86,19 @@ func (q *LKQueue) Dequeue() interface{} {
 	}
 }
 
+//Len 近似的元素个数，没有并发修改时是准确的
+func (q *LKQueue) Len() int {
+	if n := q.len.Load(); n > 0 {
+		return int(n)
+	}
+	//出队的计数可能先于入队的计数被修改
+	return 0
+}
+
+//IsEmpty 调用的这一刻队列是否为空
+func (q *LKQueue) IsEmpty() bool {
+	return load(&load(&q.head).next) == nil
+}
 
 //将 unsafe.Pointer原子加载转换成node
 func load(p *unsafe.Pointer) (n *node) {
@@ -84,4 +108,4 @@ func load(p *unsafe.Pointer) (n *node) {
 // 封装cas,避免直接将*node转换成unsafe.Pointer
 func cas(p *unsafe.Pointer, old, new *node) (ok bool) {
 	return atomic.CompareAndSwapPointer(p, unsafe.Pointer(old), unsafe.Pointer(new))
-}
\ No newline at end of file
+}
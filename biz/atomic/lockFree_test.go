@@ -0,0 +1,275 @@
+package atomic_test
+
+import (
+	"go-learn.com/v1/biz/atomic"
+	"go-learn.com/v1/biz/race"
+	"runtime"
+	"sort"
+	"sync"
+	syncatomic "sync/atomic"
+	"testing"
+)
+
+//TestLKQueueFIFO 单个 goroutine 时先进先出，Len、IsEmpty 是准确的
+func TestLKQueueFIFO(t *testing.T) {
+	q := atomic.NewLKQueue()
+	if !q.IsEmpty() || q.Len() != 0 || q.Dequeue() != nil {
+		t.Fatal("new queue is not empty")
+	}
+	for i := 0; i < 10; i++ {
+		q.Enqueue(i)
+	}
+	if q.IsEmpty() || q.Len() != 10 {
+		t.Fatalf("IsEmpty = %v, Len = %d after 10 Enqueue", q.IsEmpty(), q.Len())
+	}
+	for i := 0; i < 10; i++ {
+		if v := q.Dequeue(); v != i {
+			t.Fatalf("Dequeue = %v, want %d", v, i)
+		}
+	}
+	if !q.IsEmpty() || q.Len() != 0 || q.Dequeue() != nil {
+		t.Fatal("queue is not empty after dequeuing everything")
+	}
+}
+
+//op 历史记录中的一次操作，call、ret 是全局逻辑时钟上的调用和返回时刻
+type op struct {
+	enqueue   bool
+	value     int //出队为空时是 -1
+	call, ret int64
+}
+
+//history 每个 goroutine 单独记录，结束之后再合并，避免记录本身引入同步
+type history struct {
+	clock int64
+	ops   [][]op
+}
+
+func (h *history) now() int64 {
+	return syncatomic.AddInt64(&h.clock, 1)
+}
+
+//TestLKQueueLinearizable 并发生产消费，记录每次操作的调用和返回时刻，检查 FIFO 队列可线性化的必要条件：
+//1、每个元素恰好出队一次，出队的值一定入队过
+//2、enq(a) 在 enq(b) 开始之前就返回了，那么 deq(b) 不能在 deq(a) 开始之前就返回
+//3、出队为空的整个区间内，不能有一个元素一直在队列中（入队在区间开始前返回，出队在区间结束后才开始）
+func TestLKQueueLinearizable(t *testing.T) {
+	const goroutines, opsPerGoroutine = 8, 2000
+	for round := 0; round < 5; round++ {
+		q := atomic.NewLKQueue()
+		h := &history{ops: make([][]op, goroutines)}
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < opsPerGoroutine; i++ {
+					if (i+g)%2 == 0 {
+						v := g*opsPerGoroutine + i
+						call := h.now()
+						q.Enqueue(v)
+						h.ops[g] = append(h.ops[g], op{enqueue: true, value: v, call: call, ret: h.now()})
+					} else {
+						call := h.now()
+						v := q.Dequeue()
+						o := op{value: -1, call: call, ret: h.now()}
+						if v != nil {
+							o.value = v.(int)
+						}
+						h.ops[g] = append(h.ops[g], o)
+					}
+					if i%64 == 0 {
+						runtime.Gosched()
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		//取出剩下的元素
+		var rest []op
+		for v := q.Dequeue(); v != nil; v = q.Dequeue() {
+			now := h.now()
+			rest = append(rest, op{value: v.(int), call: now, ret: now})
+		}
+		if !q.IsEmpty() || q.Len() != 0 {
+			t.Fatalf("IsEmpty = %v, Len = %d after draining", q.IsEmpty(), q.Len())
+		}
+		checkQueueHistory(t, append(h.ops, rest))
+	}
+}
+
+func checkQueueHistory(t *testing.T, ops [][]op) {
+	t.Helper()
+	enq := make(map[int]op)
+	deq := make(map[int]op)
+	var empties []op
+	for _, g := range ops {
+		for _, o := range g {
+			switch {
+			case o.enqueue:
+				enq[o.value] = o
+			case o.value < 0:
+				empties = append(empties, o)
+			default:
+				if _, ok := deq[o.value]; ok {
+					t.Fatalf("%d dequeued twice", o.value)
+				}
+				deq[o.value] = o
+			}
+		}
+	}
+
+	//条件 1
+	for v := range deq {
+		if _, ok := enq[v]; !ok {
+			t.Fatalf("%d dequeued but never enqueued", v)
+		}
+	}
+	for v := range enq {
+		if _, ok := deq[v]; !ok {
+			t.Fatalf("%d enqueued but never dequeued", v)
+		}
+	}
+
+	//条件 2，按入队的返回时刻排序之后用扫描代替两两比较：
+	//对每个 enq(b)，在它开始之前返回的所有 enq(a) 中，deq(a) 最晚的开始时刻不能晚于 deq(b) 的返回时刻
+	byRet := make([]op, 0, len(enq))
+	for _, o := range enq {
+		byRet = append(byRet, o)
+	}
+	sort.Slice(byRet, func(i, j int) bool { return byRet[i].ret < byRet[j].ret })
+	byCall := append([]op(nil), byRet...)
+	sort.Slice(byCall, func(i, j int) bool { return byCall[i].call < byCall[j].call })
+	var latestDeqCall int64
+	latestValue, j := -1, 0
+	for _, b := range byCall {
+		for ; j < len(byRet) && byRet[j].ret < b.call; j++ {
+			if c := deq[byRet[j].value].call; c > latestDeqCall {
+				latestDeqCall, latestValue = c, byRet[j].value
+			}
+		}
+		if latestValue >= 0 && deq[b.value].ret < latestDeqCall {
+			t.Fatalf("%d was enqueued after %d but dequeued before it", b.value, latestValue)
+		}
+	}
+
+	//条件 3，同样按入队的返回时刻扫描：maxDeqCall[i] 是前 i+1 个入队元素中最晚的出队开始时刻
+	maxDeqCall := make([]int64, len(byRet))
+	for i, o := range byRet {
+		maxDeqCall[i] = deq[o.value].call
+		if i > 0 && maxDeqCall[i-1] > maxDeqCall[i] {
+			maxDeqCall[i] = maxDeqCall[i-1]
+		}
+	}
+	for _, e := range empties {
+		n := sort.Search(len(byRet), func(i int) bool { return byRet[i].ret >= e.call })
+		if n > 0 && maxDeqCall[n-1] > e.ret {
+			t.Fatalf("Dequeue returned nil during [%d, %d] while an element was in the queue", e.call, e.ret)
+		}
+	}
+}
+
+//queue 基准测试中比较的队列
+type queue interface {
+	Enqueue(v interface{})
+	Dequeue() interface{}
+}
+
+type chanQueue chan interface{}
+
+func (c chanQueue) Enqueue(v interface{}) { c <- v }
+func (c chanQueue) Dequeue() interface{} {
+	select {
+	case v := <-c:
+		return v
+	default:
+		return nil
+	}
+}
+
+//ringQueue 入队用阻塞模式，和 chan 一样队满时等待
+type ringQueue struct{ r *atomic.Ring }
+
+func (q ringQueue) Enqueue(v interface{}) { q.r.Enqueue(v) }
+func (q ringQueue) Dequeue() interface{} {
+	v, _ := q.r.TryDequeue()
+	return v
+}
+
+var queues = []struct {
+	name string
+	new  func() queue
+}{
+	{"LKQueue", func() queue { return atomic.NewLKQueue() }},
+	{"SliceQueue", func() queue { return race.NewSliceQueue(1024) }},
+	{"Ring", func() queue { return ringQueue{atomic.NewRing(1 << 16)} }},
+	{"chan", func() queue { return make(chanQueue, 1<<16) }},
+}
+
+//BenchmarkQueueSequential 单个 goroutine 入队再出队，没有竞争时的开销
+func BenchmarkQueueSequential(b *testing.B) {
+	for _, qb := range queues {
+		b.Run(qb.name, func(b *testing.B) {
+			q := qb.new()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				q.Enqueue(i)
+				q.Dequeue()
+			}
+		})
+	}
+}
+
+//BenchmarkQueueParallel 所有 P 同时入队、出队
+func BenchmarkQueueParallel(b *testing.B) {
+	for _, qb := range queues {
+		b.Run(qb.name, func(b *testing.B) {
+			q := qb.new()
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					q.Enqueue(i)
+					q.Dequeue()
+					i++
+				}
+			})
+		})
+	}
+}
+
+//BenchmarkQueueProducerConsumer 一半 goroutine 只入队，一半只出队
+func BenchmarkQueueProducerConsumer(b *testing.B) {
+	for _, qb := range queues {
+		b.Run(qb.name, func(b *testing.B) {
+			q := qb.new()
+			pairs := runtime.GOMAXPROCS(0)/2 + 1
+			per := b.N/pairs + 1
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			var wg sync.WaitGroup
+			for p := 0; p < pairs; p++ {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < per; i++ {
+						q.Enqueue(i)
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					for got := 0; got < per; {
+						if q.Dequeue() != nil {
+							got++
+						} else {
+							runtime.Gosched()
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package atomic
+
+/**
+ @desc 上面提到的 uber-go/atomic 风格的原子类型：Bool、Int32、Int64、Uint32、Uint64、Float64、Duration、String、Error、Time
+ @date 2026-10-18
+*/
+
+//这些类型的零值都可以直接使用，都提供 Load、Store、Swap、CompareAndSwap，数值类型还提供 Add/Sub，
+//都实现了 json.Marshaler 和 json.Unmarshaler，可以直接放在配置结构体中。
+//和 sync.Mutex 一样，使用之后不能复制：复制得到的是一个独立的值，对副本的修改其他 goroutine 看不到。
+
+//noCopy 嵌入到不能复制的类型中，go vet 的 copylocks 检查会报告对这些类型的复制
+type noCopy struct{}
+
+//Lock 只是给 go vet 看的
+func (*noCopy) Lock() {}
+
+//Unlock 只是给 go vet 看的
+func (*noCopy) Unlock() {}
@@ -0,0 +1,246 @@
+package atomic
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+/**
+ @desc 有界的 lock-free 多生产者多消费者环形队列（Dmitry Vyukov 的序号算法），可选的阻塞模式
+ @date 2026-10-18
+*/
+
+//LKQueue 每个元素都要分配一个节点，Ring 在创建时就分配好所有的格子，入队出队不再分配内存。
+//每个格子有一个序号 seq：
+//  seq == pos        格子是空的，可以写入位置 pos 的元素
+//  seq == pos+1      格子里是位置 pos 的元素，可以读取
+//  seq == pos+容量   读取完成，格子留给下一圈的 pos+容量
+//生产者用 CAS 抢占 enqueuePos，消费者用 CAS 抢占 dequeuePos，抢到位置之后只有自己会访问那个格子。
+//
+//TryEnqueue/TryDequeue 从不阻塞；Enqueue/Dequeue 在队满、队空时把 goroutine 挂起，
+//不使用阻塞方法时只多一次原子读（检查有没有等待者）。
+
+//ErrRingClosed Ring 已经关闭（Dequeue 时也已经取空）
+var ErrRingClosed = errors.New("atomic: ring closed")
+
+//cacheLinePad 让生产者和消费者的位置落在不同的缓存行，避免伪共享
+type cacheLinePad [64]byte
+
+type cell struct {
+	seq   uint64
+	value interface{}
+}
+
+//Ring 有界的 lock-free 环形队列，需要通过 NewRing 创建
+type Ring struct {
+	_          cacheLinePad
+	enqueuePos uint64
+	_          cacheLinePad
+	dequeuePos uint64
+	_          cacheLinePad
+
+	mask  uint64
+	cells []cell
+
+	closed   Bool
+	notFull  parker //等待空位的生产者
+	notEmpty parker //等待元素的消费者
+}
+
+//NewRing 创建容量至少为 capacity 的 Ring，容量会向上取整到 2 的幂
+func NewRing(capacity int) *Ring {
+	if capacity <= 0 {
+		panic("atomic: Ring capacity must be positive")
+	}
+	n := 2
+	for n < capacity {
+		n <<= 1
+	}
+	r := &Ring{mask: uint64(n - 1), cells: make([]cell, n)}
+	for i := range r.cells {
+		r.cells[i].seq = uint64(i)
+	}
+	r.notFull.init()
+	r.notEmpty.init()
+	return r
+}
+
+//TryEnqueue 入队，队满或者已经关闭时返回 false
+func (r *Ring) TryEnqueue(v interface{}) bool {
+	if r.closed.Load() {
+		return false
+	}
+	pos := atomic.LoadUint64(&r.enqueuePos)
+	for {
+		c := &r.cells[pos&r.mask]
+		dif := int64(atomic.LoadUint64(&c.seq) - pos)
+		if dif == 0 {
+			if atomic.CompareAndSwapUint64(&r.enqueuePos, pos, pos+1) {
+				c.value = v
+				atomic.StoreUint64(&c.seq, pos+1)
+				r.notEmpty.wake()
+				return true
+			}
+		} else if dif < 0 {
+			//上一圈的元素还没有被取走
+			return false
+		}
+		pos = atomic.LoadUint64(&r.enqueuePos)
+	}
+}
+
+//TryDequeue 出队，队空时返回 false
+func (r *Ring) TryDequeue() (interface{}, bool) {
+	pos := atomic.LoadUint64(&r.dequeuePos)
+	for {
+		c := &r.cells[pos&r.mask]
+		dif := int64(atomic.LoadUint64(&c.seq) - (pos + 1))
+		if dif == 0 {
+			if atomic.CompareAndSwapUint64(&r.dequeuePos, pos, pos+1) {
+				v := c.value
+				c.value = nil
+				atomic.StoreUint64(&c.seq, pos+r.mask+1)
+				r.notFull.wake()
+				return v, true
+			}
+		} else if dif < 0 {
+			//位置 pos 的元素还没有写入
+			return nil, false
+		}
+		pos = atomic.LoadUint64(&r.dequeuePos)
+	}
+}
+
+//Enqueue 入队，队满时阻塞，关闭后返回 ErrRingClosed
+func (r *Ring) Enqueue(v interface{}) error {
+	return r.EnqueueContext(context.Background(), v)
+}
+
+//EnqueueContext 入队，队满时阻塞直到有空位、ctx 被取消或者 Ring 被关闭
+func (r *Ring) EnqueueContext(ctx context.Context, v interface{}) error {
+	for {
+		if r.TryEnqueue(v) {
+			return nil
+		}
+		if r.closed.Load() {
+			return ErrRingClosed
+		}
+		if err := r.notFull.wait(ctx, r.canEnqueue); err != nil {
+			return err
+		}
+	}
+}
+
+//Dequeue 出队，队空时阻塞，关闭并且取空之后返回 ErrRingClosed
+func (r *Ring) Dequeue() (interface{}, error) {
+	return r.DequeueContext(context.Background())
+}
+
+//DequeueContext 出队，队空时阻塞直到有元素、ctx 被取消或者 Ring 被关闭
+func (r *Ring) DequeueContext(ctx context.Context) (interface{}, error) {
+	for {
+		if v, ok := r.TryDequeue(); ok {
+			return v, nil
+		}
+		if r.closed.Load() {
+			//关闭之前最后写入的元素可能刚刚可读
+			if v, ok := r.TryDequeue(); ok {
+				return v, nil
+			}
+			return nil, ErrRingClosed
+		}
+		if err := r.notEmpty.wait(ctx, r.canDequeue); err != nil {
+			return nil, err
+		}
+	}
+}
+
+//Close 关闭 Ring，唤醒所有阻塞的 goroutine；之后入队失败，出队取完剩下的元素后返回 ErrRingClosed。
+//和 Close 同时进行的 TryEnqueue 可能仍然成功，元素一样可以被取出
+func (r *Ring) Close() {
+	if r.closed.Swap(true) {
+		return
+	}
+	r.notFull.broadcast()
+	r.notEmpty.broadcast()
+}
+
+//canEnqueue 下一个入队位置的格子是空的
+func (r *Ring) canEnqueue() bool {
+	pos := atomic.LoadUint64(&r.enqueuePos)
+	return r.closed.Load() || int64(atomic.LoadUint64(&r.cells[pos&r.mask].seq)-pos) >= 0
+}
+
+//canDequeue 下一个出队位置的格子已经写入
+func (r *Ring) canDequeue() bool {
+	pos := atomic.LoadUint64(&r.dequeuePos)
+	return r.closed.Load() || int64(atomic.LoadUint64(&r.cells[pos&r.mask].seq)-(pos+1)) >= 0
+}
+
+//Len 近似的元素个数，包括已经抢到位置但还没有写完或者读完的
+func (r *Ring) Len() int {
+	deq := atomic.LoadUint64(&r.dequeuePos)
+	enq := atomic.LoadUint64(&r.enqueuePos)
+	if enq <= deq {
+		return 0
+	}
+	if n := int(enq - deq); n < r.Cap() {
+		return n
+	}
+	return r.Cap()
+}
+
+//Cap 容量
+func (r *Ring) Cap() int {
+	return len(r.cells)
+}
+
+//parker 挂起等待某个条件的 goroutine。
+//等待者先增加 waiters 再检查条件，唤醒者先改变状态再读取 waiters，
+//两边都是顺序一致的原子操作，所以要么唤醒者看到等待者，要么等待者看到新的状态，不会丢失唤醒
+type parker struct {
+	waiters int32
+	mu      sync.Mutex
+	ch      chan struct{} //每次唤醒关闭当前的 ch，换一个新的
+}
+
+func (p *parker) init() {
+	p.ch = make(chan struct{})
+}
+
+//wait 阻塞直到被唤醒、ready 成立或者 ctx 被取消
+func (p *parker) wait(ctx context.Context, ready func() bool) error {
+	p.mu.Lock()
+	atomic.AddInt32(&p.waiters, 1)
+	if ready() {
+		atomic.AddInt32(&p.waiters, -1)
+		p.mu.Unlock()
+		return nil
+	}
+	ch := p.ch
+	p.mu.Unlock()
+
+	defer atomic.AddInt32(&p.waiters, -1)
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//wake 有等待者时唤醒所有等待者，被唤醒的 goroutine 会重新尝试
+func (p *parker) wake() {
+	if atomic.LoadInt32(&p.waiters) > 0 {
+		p.broadcast()
+	}
+}
+
+func (p *parker) broadcast() {
+	p.mu.Lock()
+	close(p.ch)
+	p.ch = make(chan struct{})
+	p.mu.Unlock()
+}
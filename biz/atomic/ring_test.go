@@ -0,0 +1,225 @@
+package atomic_test
+
+import (
+	"context"
+	"go-learn.com/v1/biz/atomic"
+	"runtime"
+	"sync"
+	syncatomic "sync/atomic"
+	"testing"
+	"time"
+)
+
+//TestRingFIFO 容量取整到 2 的幂，队满、队空时 Try 方法立即失败，绕过几圈之后仍然先进先出
+func TestRingFIFO(t *testing.T) {
+	r := atomic.NewRing(3)
+	if r.Cap() != 4 {
+		t.Fatalf("Cap = %d, want 4", r.Cap())
+	}
+	if _, ok := r.TryDequeue(); ok {
+		t.Fatal("TryDequeue on empty ring succeeded")
+	}
+	next := 0
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 4; i++ {
+			if !r.TryEnqueue(round*4 + i) {
+				t.Fatalf("TryEnqueue %d failed", round*4+i)
+			}
+		}
+		if r.TryEnqueue(-1) {
+			t.Fatal("TryEnqueue on full ring succeeded")
+		}
+		if r.Len() != 4 {
+			t.Fatalf("Len = %d, want 4", r.Len())
+		}
+		for i := 0; i < 4; i++ {
+			v, ok := r.TryDequeue()
+			if !ok || v != next {
+				t.Fatalf("TryDequeue = %v, %v, want %d", v, ok, next)
+			}
+			next++
+		}
+	}
+	if r.Len() != 0 {
+		t.Fatalf("Len = %d after draining", r.Len())
+	}
+}
+
+//TestRingMPMC 多个生产者、消费者并发使用 Try 方法：每个元素恰好出队一次，同一个生产者的元素保持顺序
+func TestRingMPMC(t *testing.T) {
+	const producers, consumers, perProducer = 4, 4, 5000
+	r := atomic.NewRing(8)
+
+	type item struct{ producer, seq int }
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; {
+				if r.TryEnqueue(item{p, i}) {
+					i++
+				} else {
+					runtime.Gosched()
+				}
+			}
+		}(p)
+	}
+
+	results := make([][]item, consumers)
+	var received int64
+	var total sync.WaitGroup
+	for c := 0; c < consumers; c++ {
+		total.Add(1)
+		go func(c int) {
+			defer total.Done()
+			for syncatomic.LoadInt64(&received) < producers*perProducer {
+				if v, ok := r.TryDequeue(); ok {
+					results[c] = append(results[c], v.(item))
+					syncatomic.AddInt64(&received, 1)
+				} else {
+					runtime.Gosched()
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	total.Wait()
+
+	seen := make(map[item]bool)
+	for _, got := range results {
+		last := make(map[int]int)
+		for _, it := range got {
+			if seen[it] {
+				t.Fatalf("%+v dequeued twice", it)
+			}
+			seen[it] = true
+			if prev, ok := last[it.producer]; ok && it.seq <= prev {
+				t.Fatalf("producer %d: seq %d after %d", it.producer, it.seq, prev)
+			}
+			last[it.producer] = it.seq
+		}
+	}
+	if len(seen) != producers*perProducer {
+		t.Fatalf("dequeued %d items, want %d", len(seen), producers*perProducer)
+	}
+}
+
+//TestRingBlocking 阻塞模式：容量很小时生产者、消费者交替挂起，所有元素都能送达，Close 之后消费者取完剩下的元素再返回
+func TestRingBlocking(t *testing.T) {
+	const producers, perProducer = 4, 2000
+	r := atomic.NewRing(2)
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				if err := r.Enqueue(p*perProducer + i); err != nil {
+					t.Errorf("Enqueue: %v", err)
+					return
+				}
+			}
+		}(p)
+	}
+
+	got := make(chan int, producers*perProducer)
+	var consumers sync.WaitGroup
+	for c := 0; c < 3; c++ {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				v, err := r.Dequeue()
+				if err == atomic.ErrRingClosed {
+					return
+				}
+				if err != nil {
+					t.Errorf("Dequeue: %v", err)
+					return
+				}
+				got <- v.(int)
+			}
+		}()
+	}
+
+	wg.Wait()
+	r.Close()
+	consumers.Wait()
+	close(got)
+
+	seen := make(map[int]bool)
+	for v := range got {
+		if seen[v] {
+			t.Fatalf("%d dequeued twice", v)
+		}
+		seen[v] = true
+	}
+	if len(seen) != producers*perProducer {
+		t.Fatalf("dequeued %d items, want %d", len(seen), producers*perProducer)
+	}
+}
+
+//TestRingClose Close 唤醒阻塞的生产者和消费者
+func TestRingClose(t *testing.T) {
+	empty := atomic.NewRing(1)
+	full := atomic.NewRing(1)
+	for full.TryEnqueue(0) {
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := empty.Dequeue()
+		errs <- err
+	}()
+	go func() {
+		errs <- full.Enqueue(1)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	empty.Close()
+	full.Close()
+	full.Close() //重复关闭没有影响
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if err != atomic.ErrRingClosed {
+				t.Fatalf("err = %v, want ErrRingClosed", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("blocked goroutine was not woken by Close")
+		}
+	}
+
+	//关闭之后仍然可以取出剩下的元素
+	for i := 0; i < full.Cap(); i++ {
+		if v, err := full.Dequeue(); err != nil || v != 0 {
+			t.Fatalf("Dequeue after Close = %v, %v", v, err)
+		}
+	}
+	if _, err := full.Dequeue(); err != atomic.ErrRingClosed {
+		t.Fatalf("Dequeue on drained closed ring = %v", err)
+	}
+	if full.TryEnqueue(2) {
+		t.Fatal("TryEnqueue after Close succeeded")
+	}
+}
+
+//TestRingContext 阻塞的操作可以被 ctx 取消
+func TestRingContext(t *testing.T) {
+	r := atomic.NewRing(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.DequeueContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("DequeueContext = %v, want DeadlineExceeded", err)
+	}
+
+	for r.TryEnqueue(0) {
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := r.EnqueueContext(ctx, 1); err != context.DeadlineExceeded {
+		t.Fatalf("EnqueueContext = %v, want DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,126 @@
+package atomic
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+/**
+ @desc 顺序锁 SeqLock：读多写少的多字段结构体，读者不加锁、不分配内存，读到不一致的数据时重试
+ @date 2026-10-18
+*/
+
+//atomic.Value 每次 Store 都要分配一个新值，Load 返回 interface{} 还要类型断言；
+//Config 这样几个字段的结构体每秒被读几百万次时，可以直接原地读写，用一个序号判断读到的是否一致：
+// 写者加锁，把 seq 加一（变成奇数），修改数据，再把 seq 加一（变回偶数）
+// 读者先读 seq，是奇数说明正在写，等一等；然后复制数据，再读一次 seq，
+// 两次相同说明复制的过程中没有写入，否则重试
+//读者复制到的数据可能是撕裂的（一半旧一半新），在重新检查 seq 之前只能复制，不能使用：
+//比如不能按撕裂的长度去访问切片、不能解引用指针里的字段。
+//
+//读者和写者对数据的访问在 Go 的内存模型里是数据竞争，-race 会报告。
+//另外 Go 没有单独的读屏障，复制数据的普通读和第二次读 seq 之间的顺序依赖于 CPU：
+//amd64 上读读不会重排，arm64 这样弱内存序的 CPU 上可能读到撕裂的数据却通过了检查。
+//所以只有 amd64 并且没有 -race 时读者才是无锁的，其他情况（见 seqlock_locked.go）读者改为持有读锁，语义不变，只是不再无锁。
+
+//SeqLock 顺序锁，零值可以直接使用，使用之后不能复制
+type SeqLock struct {
+	_   noCopy
+	seq uint64
+	mu  sync.Mutex
+	rw  sync.RWMutex //只在 lockedReaders 时使用
+}
+
+//BeginRead 开始一次读，返回当前的序号。之后必须调用 Retry，Retry 返回 true 时要重新 BeginRead
+func (l *SeqLock) BeginRead() uint64 {
+	if lockedReaders {
+		l.rw.RLock()
+		return atomic.LoadUint64(&l.seq)
+	}
+	for {
+		seq := atomic.LoadUint64(&l.seq)
+		if seq&1 == 0 {
+			return seq
+		}
+		runtime.Gosched() //写者持有锁，让它先完成
+	}
+}
+
+//Retry 结束一次读，读的过程中发生了写入时返回 true，复制到的数据要丢弃
+func (l *SeqLock) Retry(seq uint64) bool {
+	if lockedReaders {
+		l.rw.RUnlock()
+		return false
+	}
+	return atomic.LoadUint64(&l.seq) != seq
+}
+
+//Read 反复执行 read，直到读到一致的数据。read 只能复制数据，可能被执行多次
+func (l *SeqLock) Read(read func()) {
+	for {
+		seq := l.BeginRead()
+		read()
+		if !l.Retry(seq) {
+			return
+		}
+	}
+}
+
+//Lock 开始写，写者之间互斥
+func (l *SeqLock) Lock() {
+	l.mu.Lock()
+	if lockedReaders {
+		l.rw.Lock()
+	}
+	atomic.AddUint64(&l.seq, 1)
+}
+
+//Unlock 结束写
+func (l *SeqLock) Unlock() {
+	atomic.AddUint64(&l.seq, 1)
+	if lockedReaders {
+		l.rw.Unlock()
+	}
+	l.mu.Unlock()
+}
+
+//Write 持有写锁执行 write
+func (l *SeqLock) Write(write func()) {
+	l.Lock()
+	defer l.Unlock()
+	write()
+}
+
+//Sequence 当前的序号，每次写入加 2，可以用来判断数据有没有变化
+func (l *SeqLock) Sequence() uint64 {
+	return atomic.LoadUint64(&l.seq)
+}
+
+//SeqConfig 用 SeqLock 保护的 Config，Load 返回一份一致的副本
+type SeqConfig struct {
+	lock SeqLock
+	c    Config
+}
+
+//Load 返回当前的配置
+func (s *SeqConfig) Load() Config {
+	var c Config
+	s.lock.Read(func() { c = s.c })
+	return c
+}
+
+//Store 替换配置
+func (s *SeqConfig) Store(c Config) {
+	s.lock.Lock()
+	s.c = c
+	s.lock.Unlock()
+}
+
+//Update 在写锁内修改配置，返回修改之后的值
+func (s *SeqConfig) Update(update func(c *Config)) Config {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	update(&s.c)
+	return s.c
+}
@@ -0,0 +1,8 @@
+//go:build race || !amd64
+// +build race !amd64
+
+package atomic
+
+//lockedReaders 为 true 时 SeqLock 的读者改为加读锁：-race 会把无锁的读报告成数据竞争，
+//非 amd64 的平台上复制数据的普通读可能被重排到第二次读 seq 之后
+const lockedReaders = true
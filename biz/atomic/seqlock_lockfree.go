@@ -0,0 +1,7 @@
+//go:build !race && amd64
+// +build !race,amd64
+
+package atomic
+
+//lockedReaders 为 true 时 SeqLock 的读者改为加读锁，只有 amd64 并且没有 -race 时读者才是无锁的
+const lockedReaders = false
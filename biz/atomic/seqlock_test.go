@@ -0,0 +1,199 @@
+package atomic_test
+
+import (
+	"go-learn.com/v1/biz/atomic"
+	"runtime"
+	"strconv"
+	"sync"
+	syncatomic "sync/atomic"
+	"testing"
+	"time"
+)
+
+//wide 几个字段的结构体，字段之间的关系可以用来检查读到的是不是一致的快照
+type wide struct {
+	A, B, C, D int64
+	Name       string
+}
+
+func newWide(n int64) wide {
+	return wide{A: n, B: -n, C: n * 2, D: n * 3, Name: strconv.FormatInt(n, 10)}
+}
+
+func (w wide) check() bool {
+	return w.B == -w.A && w.C == w.A*2 && w.D == w.A*3 && w.Name == strconv.FormatInt(w.A, 10)
+}
+
+//TestSeqLockConsistent 写者不停修改时，读者每次读到的都是某一次写入的完整快照，并且版本不会倒退
+func TestSeqLockConsistent(t *testing.T) {
+	var (
+		l    atomic.SeqLock
+		data = newWide(0)
+		stop int32
+	)
+	const writes = 20000
+
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var last int64
+			for syncatomic.LoadInt32(&stop) == 0 {
+				var w wide
+				l.Read(func() { w = data })
+				if !w.check() {
+					t.Errorf("torn read: %+v", w)
+					return
+				}
+				if w.A < last {
+					t.Errorf("read %d after %d", w.A, last)
+					return
+				}
+				last = w.A
+				runtime.Gosched()
+			}
+		}()
+	}
+
+	var writers sync.WaitGroup
+	var next int64
+	for w := 0; w < 2; w++ {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for i := 0; i < writes/2; i++ {
+				l.Write(func() {
+					next++
+					data = newWide(next)
+				})
+				if i%16 == 0 {
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+	writers.Wait()
+	syncatomic.StoreInt32(&stop, 1)
+	wg.Wait()
+
+	if data.A != writes || l.Sequence() != 2*writes {
+		t.Fatalf("A = %d, Sequence = %d after %d writes", data.A, l.Sequence(), writes)
+	}
+}
+
+//TestSeqLockRetry 手动 BeginRead/Retry：读的过程中发生写入时 Retry 返回 true（读者加锁时写者要等读者结束，不会发生）
+func TestSeqLockRetry(t *testing.T) {
+	var l atomic.SeqLock
+	seq := l.BeginRead()
+	if l.Retry(seq) {
+		t.Fatal("Retry without a write")
+	}
+
+	seq = l.BeginRead()
+	written := make(chan struct{})
+	go func() {
+		l.Write(func() {})
+		close(written)
+	}()
+	select {
+	case <-written:
+		if !l.Retry(seq) {
+			t.Fatal("Retry after a write returned false")
+		}
+	case <-time.After(100 * time.Millisecond):
+		//写者被读锁挡住了，说明读者是加锁的（-race 或者非 amd64）
+		if l.Retry(seq) {
+			t.Fatal("Retry returned true in locked mode")
+		}
+		<-written
+	}
+}
+
+//TestSeqConfig Load 返回 Store/Update 之后的值
+func TestSeqConfig(t *testing.T) {
+	var s atomic.SeqConfig
+	s.Store(atomic.Config{NodeName: "北京", Addr: "10.0.0.1", Count: 1})
+	got := s.Update(func(c *atomic.Config) { c.Count++ })
+	if got.Count != 2 || s.Load() != got {
+		t.Fatalf("Load = %+v, Update = %+v", s.Load(), got)
+	}
+}
+
+//configReader 三种保护 Config 的方式，比较读的开销
+type configReader interface {
+	Load() atomic.Config
+	Store(atomic.Config)
+}
+
+type valueConfig struct{ v syncatomic.Value }
+
+func (c *valueConfig) Load() atomic.Config   { return c.v.Load().(atomic.Config) }
+func (c *valueConfig) Store(v atomic.Config) { c.v.Store(v) }
+
+type rwConfig struct {
+	mu sync.RWMutex
+	c  atomic.Config
+}
+
+func (c *rwConfig) Load() atomic.Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.c
+}
+
+func (c *rwConfig) Store(v atomic.Config) {
+	c.mu.Lock()
+	c.c = v
+	c.mu.Unlock()
+}
+
+var configs = []struct {
+	name string
+	new  func() configReader
+}{
+	{"SeqConfig", func() configReader { return &atomic.SeqConfig{} }},
+	{"atomic.Value", func() configReader { return &valueConfig{} }},
+	{"RWMutex", func() configReader { return &rwConfig{} }},
+}
+
+var sinkCount int32
+
+//BenchmarkConfigRead 所有 P 只读
+func BenchmarkConfigRead(b *testing.B) {
+	for _, cb := range configs {
+		b.Run(cb.name, func(b *testing.B) {
+			c := cb.new()
+			c.Store(atomic.Config{NodeName: "北京", Addr: "10.0.0.1"})
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				var n int32
+				for pb.Next() {
+					n += c.Load().Count
+				}
+				syncatomic.AddInt32(&sinkCount, n)
+			})
+		})
+	}
+}
+
+//BenchmarkConfigReadWrite 所有 P 读，每 1000 次读有一次写
+func BenchmarkConfigReadWrite(b *testing.B) {
+	for _, cb := range configs {
+		b.Run(cb.name, func(b *testing.B) {
+			c := cb.new()
+			c.Store(atomic.Config{NodeName: "北京", Addr: "10.0.0.1"})
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				var n int32
+				for pb.Next() {
+					if n++; n%1000 == 0 {
+						c.Store(atomic.Config{NodeName: "上海", Addr: "10.0.0.2", Count: n})
+					} else {
+						c.Load()
+					}
+				}
+			})
+		})
+	}
+}
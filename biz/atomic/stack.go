@@ -0,0 +1,80 @@
+package atomic
+
+import "unsafe"
+
+//使用atomic 实现 Lock-Free stack（Treiber stack）
+/**
+	栈只需要一个栈顶指针 top，节点和 LKQueue 共用 node。
+	入栈的时候，新节点的 next 指向当前的栈顶，再通过 CAS 把栈顶换成新节点。
+	出栈的时候，读取栈顶和它的 next，再通过 CAS 把栈顶换成 next。
+*/
+
+//ABA 问题：在 C/C++ 中，goroutine A 读到栈顶 X 和 X.next = Y 之后被挂起，
+//B 弹出 X、弹出 Y、释放它们，再压入一个恰好分配在 X 原来地址上的新节点，
+//A 恢复后 CAS(top, X, Y) 依然成功，栈顶变成了已经释放的 Y。
+//在 Go 中这不会发生：A 手里还拿着 X 的指针，GC 不会回收 X，X 的地址也就不会被新的节点复用；
+//并且这里每次 Push 都分配新节点，弹出的节点从不修改、从不放回去复用。
+//所以 top 等于 X 时，它一定还是 A 读到的那个 X，X.next 也没有变过。
+//注意不要为了减少分配把节点放进 sync.Pool 或者自己的空闲链表，那样就把 ABA 问题带回来了。
+
+//LKStack lock-free 的栈，零值可用
+type LKStack struct {
+	top unsafe.Pointer //*node
+	//len 近似的元素个数，和 LKQueue 一样在 CAS 成功之后才修改
+	len Int64
+}
+
+//NewLKStack 创建空栈
+func NewLKStack() *LKStack {
+	return &LKStack{}
+}
+
+//Push 入栈
+func (s *LKStack) Push(v interface{}) {
+	n := &node{value: v}
+	for {
+		top := load(&s.top)
+		n.next = unsafe.Pointer(top) //n 还没有发布，其他 goroutine 看不到，不需要原子操作
+		if cas(&s.top, top, n) {
+			s.len.Inc()
+			return
+		}
+	}
+}
+
+//Pop 出栈，栈为空时返回 false
+func (s *LKStack) Pop() (interface{}, bool) {
+	for {
+		top := load(&s.top)
+		if top == nil {
+			return nil, false
+		}
+		next := load(&top.next)
+		if cas(&s.top, top, next) {
+			s.len.Dec()
+			return top.value, true
+		}
+	}
+}
+
+//Peek 返回栈顶的元素但不出栈，栈为空时返回 false
+func (s *LKStack) Peek() (interface{}, bool) {
+	top := load(&s.top)
+	if top == nil {
+		return nil, false
+	}
+	return top.value, true
+}
+
+//Len 近似的元素个数，没有并发修改时是准确的
+func (s *LKStack) Len() int {
+	if n := s.len.Load(); n > 0 {
+		return int(n)
+	}
+	return 0
+}
+
+//IsEmpty 调用的这一刻栈是否为空
+func (s *LKStack) IsEmpty() bool {
+	return load(&s.top) == nil
+}
@@ -0,0 +1,159 @@
+package atomic_test
+
+import (
+	"go-learn.com/v1/biz/atomic"
+	"go-learn.com/v1/biz/stress"
+	"runtime"
+	"sync"
+	syncatomic "sync/atomic"
+	"testing"
+)
+
+//TestLKStackLIFO 单个 goroutine 时后进先出，Peek 不出栈，可以存放 nil
+func TestLKStackLIFO(t *testing.T) {
+	var s atomic.LKStack
+	if _, ok := s.Pop(); ok || !s.IsEmpty() || s.Len() != 0 {
+		t.Fatal("zero value stack is not empty")
+	}
+	for i := 0; i < 10; i++ {
+		s.Push(i)
+	}
+	s.Push(nil)
+	if v, ok := s.Peek(); !ok || v != nil || s.Len() != 11 {
+		t.Fatalf("Peek = %v, %v, Len = %d", v, ok, s.Len())
+	}
+	if v, ok := s.Pop(); !ok || v != nil {
+		t.Fatalf("Pop = %v, %v, want nil, true", v, ok)
+	}
+	for i := 9; i >= 0; i-- {
+		if v, ok := s.Peek(); !ok || v != i {
+			t.Fatalf("Peek = %v, want %d", v, i)
+		}
+		if v, ok := s.Pop(); !ok || v != i {
+			t.Fatalf("Pop = %v, want %d", v, i)
+		}
+	}
+	if _, ok := s.Peek(); ok || !s.IsEmpty() || s.Len() != 0 {
+		t.Fatal("stack is not empty after popping everything")
+	}
+}
+
+//TestLKStackStress 并发入栈出栈，每个元素恰好出栈一次
+func TestLKStackStress(t *testing.T) {
+	cfg := stress.Config{Goroutines: 8, Ops: 5000, YieldProb: 0.05}
+	if testing.Short() {
+		cfg.Ops = 500
+	}
+	stress.RunT(t, cfg, stress.StackScenario("LKStack", func() stress.Stack { return atomic.NewLKStack() }))
+}
+
+//TestLKStackABA 反复弹出再压入同样的值：每次 Push 都是新的节点，栈顶的 CAS 不会被同一个值骗过
+func TestLKStackABA(t *testing.T) {
+	var s atomic.LKStack
+	const goroutines, rounds = 4, 5000
+	for i := 0; i < goroutines; i++ {
+		s.Push(i)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				v, ok := s.Pop()
+				for !ok {
+					runtime.Gosched()
+					v, ok = s.Pop()
+				}
+				s.Push(v)
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[interface{}]bool)
+	for v, ok := s.Pop(); ok; v, ok = s.Pop() {
+		if seen[v] {
+			t.Fatalf("%v popped twice", v)
+		}
+		seen[v] = true
+	}
+	if len(seen) != goroutines {
+		t.Fatalf("%d values left, want %d", len(seen), goroutines)
+	}
+}
+
+//mutexStack 用 Mutex 保护的 slice 实现的栈，用来和 LKStack 比较
+type mutexStack struct {
+	mu    sync.Mutex
+	items []interface{}
+}
+
+func (s *mutexStack) Push(v interface{}) {
+	s.mu.Lock()
+	s.items = append(s.items, v)
+	s.mu.Unlock()
+}
+
+func (s *mutexStack) Pop() (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.items) == 0 {
+		return nil, false
+	}
+	v := s.items[len(s.items)-1]
+	s.items[len(s.items)-1] = nil
+	s.items = s.items[:len(s.items)-1]
+	return v, true
+}
+
+var stacks = []struct {
+	name string
+	new  func() stress.Stack
+}{
+	{"LKStack", func() stress.Stack { return atomic.NewLKStack() }},
+	{"mutexStack", func() stress.Stack { return &mutexStack{} }},
+}
+
+//TestMutexStack 对照组本身也要正确
+func TestMutexStack(t *testing.T) {
+	stress.RunT(t, stress.Config{Goroutines: 8, Ops: 500}, stress.StackScenario("mutexStack", stacks[1].new))
+}
+
+//BenchmarkStackSequential 单个 goroutine 入栈再出栈
+func BenchmarkStackSequential(b *testing.B) {
+	for _, sb := range stacks {
+		b.Run(sb.name, func(b *testing.B) {
+			s := sb.new()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				s.Push(i)
+				s.Pop()
+			}
+		})
+	}
+}
+
+//BenchmarkStackParallel 所有 P 同时入栈出栈
+func BenchmarkStackParallel(b *testing.B) {
+	for _, sb := range stacks {
+		b.Run(sb.name, func(b *testing.B) {
+			s := sb.new()
+			var empty int64
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					s.Push(i)
+					if _, ok := s.Pop(); !ok {
+						syncatomic.AddInt64(&empty, 1)
+					}
+					i++
+				}
+			})
+			if empty != 0 {
+				b.Fatalf("Pop found the stack empty %d times", empty)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package nocopy
+
+import "go-learn.com/v1/biz/atomic"
+
+//go vet 应该报告下面每一处复制
+
+type stats struct {
+	hits atomic.Int64
+	last atomic.Time
+}
+
+func byValue(s stats) int64 {
+	return s.hits.Load()
+}
+
+func copyAssign(b *atomic.Bool) bool {
+	c := *b
+	return c.Load()
+}
+
+func rangeCopy(xs []atomic.String) (n int) {
+	for _, x := range xs {
+		n += len(x.Load())
+	}
+	return n
+}
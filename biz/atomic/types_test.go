@@ -0,0 +1,293 @@
+package atomic_test
+
+import (
+	"encoding/json"
+	"errors"
+	"go-learn.com/v1/biz/atomic"
+	"math"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+//TestInt64 Load/Store/Swap/CompareAndSwap/Add/Sub
+func TestInt64(t *testing.T) {
+	i := atomic.NewInt64(1)
+	if got := i.Add(2); got != 3 {
+		t.Fatalf("Add = %d, want 3", got)
+	}
+	if got := i.Sub(4); got != -1 {
+		t.Fatalf("Sub = %d, want -1", got)
+	}
+	if old := i.Swap(10); old != -1 {
+		t.Fatalf("Swap = %d, want -1", old)
+	}
+	if i.CompareAndSwap(9, 11) {
+		t.Fatal("CompareAndSwap with wrong old value succeeded")
+	}
+	if !i.CompareAndSwap(10, 11) || i.Load() != 11 {
+		t.Fatalf("CompareAndSwap failed, value %d", i.Load())
+	}
+	if i.String() != "11" {
+		t.Fatalf("String = %q", i.String())
+	}
+}
+
+//TestUint32Sub 无符号数的 Sub 通过补码实现
+func TestUint32Sub(t *testing.T) {
+	var u atomic.Uint32
+	u.Store(5)
+	if got := u.Sub(2); got != 3 {
+		t.Fatalf("Sub = %d, want 3", got)
+	}
+	if got := u.Dec(); got != 2 {
+		t.Fatalf("Dec = %d, want 2", got)
+	}
+	if got := u.Sub(3); got != math.MaxUint32 {
+		t.Fatalf("Sub below zero = %d, want wrap around", got)
+	}
+
+	var u64 atomic.Uint64
+	if got := u64.Sub(1); got != math.MaxUint64 {
+		t.Fatalf("Uint64.Sub = %d, want wrap around", got)
+	}
+}
+
+//TestConcurrentAdd 并发地 Add 不会丢失更新
+func TestConcurrentAdd(t *testing.T) {
+	var (
+		i32 atomic.Int32
+		i64 atomic.Int64
+		u32 atomic.Uint32
+		u64 atomic.Uint64
+		f   atomic.Float64
+		d   atomic.Duration
+		b   atomic.Bool
+		wg  sync.WaitGroup
+	)
+	const goroutines, n = 8, 1000
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				i32.Inc()
+				i64.Inc()
+				u32.Inc()
+				u64.Inc()
+				f.Add(0.5)
+				d.Add(time.Millisecond)
+				b.Toggle()
+			}
+		}()
+	}
+	wg.Wait()
+
+	const total = goroutines * n
+	if i32.Load() != total || i64.Load() != total || u32.Load() != total || u64.Load() != total {
+		t.Fatalf("counts = %d %d %d %d, want %d", i32.Load(), i64.Load(), u32.Load(), u64.Load(), total)
+	}
+	if f.Load() != total/2 {
+		t.Fatalf("Float64 = %v, want %v", f.Load(), total/2)
+	}
+	if d.Load() != total*time.Millisecond {
+		t.Fatalf("Duration = %v", d.Load())
+	}
+	if b.Load() {
+		t.Fatal("Bool toggled an even number of times is true")
+	}
+}
+
+//TestBool Swap/CompareAndSwap/Toggle
+func TestBool(t *testing.T) {
+	b := atomic.NewBool(true)
+	if old := b.Swap(false); !old {
+		t.Fatal("Swap returned false")
+	}
+	if b.CompareAndSwap(true, false) {
+		t.Fatal("CompareAndSwap with wrong old value succeeded")
+	}
+	if !b.CompareAndSwap(false, true) || !b.Load() {
+		t.Fatal("CompareAndSwap failed")
+	}
+	if old := b.Toggle(); !old || b.Load() {
+		t.Fatalf("Toggle = %v, value %v", old, b.Load())
+	}
+}
+
+//TestFloat64 CompareAndSwap 按位比较
+func TestFloat64(t *testing.T) {
+	f := atomic.NewFloat64(math.NaN())
+	if !f.CompareAndSwap(math.NaN(), 1.5) || f.Load() != 1.5 {
+		t.Fatalf("CompareAndSwap(NaN) failed, value %v", f.Load())
+	}
+	if got := f.Sub(0.25); got != 1.25 {
+		t.Fatalf("Sub = %v", got)
+	}
+	if old := f.Swap(2); old != 1.25 || f.String() != "2" {
+		t.Fatalf("Swap = %v, String = %q", old, f.String())
+	}
+}
+
+//TestString 零值是空字符串
+func TestString(t *testing.T) {
+	var s atomic.String
+	if s.Load() != "" {
+		t.Fatalf("zero value = %q", s.Load())
+	}
+	if !s.CompareAndSwap("", "a") {
+		t.Fatal("CompareAndSwap on zero value failed")
+	}
+	if s.CompareAndSwap("b", "c") {
+		t.Fatal("CompareAndSwap with wrong old value succeeded")
+	}
+	if old := s.Swap("b"); old != "a" || s.Load() != "b" {
+		t.Fatalf("Swap = %q, value %q", old, s.Load())
+	}
+}
+
+//TestError 可以保存 nil
+func TestError(t *testing.T) {
+	errA, errB := errors.New("a"), errors.New("b")
+	var e atomic.Error
+	if e.Load() != nil {
+		t.Fatalf("zero value = %v", e.Load())
+	}
+	e.Store(errA)
+	if e.CompareAndSwap(errB, nil) {
+		t.Fatal("CompareAndSwap with wrong old value succeeded")
+	}
+	if !e.CompareAndSwap(errA, nil) || e.Load() != nil {
+		t.Fatalf("CompareAndSwap to nil failed, value %v", e.Load())
+	}
+	if old := e.Swap(errB); old != nil || e.Load() != errB {
+		t.Fatalf("Swap = %v, value %v", old, e.Load())
+	}
+}
+
+//TestTime CompareAndSwap 按 Equal 比较
+func TestTime(t *testing.T) {
+	now := time.Now()
+	tm := atomic.NewTime(now)
+	if !tm.Load().Equal(now) {
+		t.Fatalf("Load = %v, want %v", tm.Load(), now)
+	}
+	if !tm.CompareAndSwap(now.Round(0), now.Add(time.Second)) {
+		t.Fatal("CompareAndSwap without monotonic reading failed")
+	}
+	if old := tm.Swap(time.Time{}); !old.Equal(now.Add(time.Second)) || !tm.Load().IsZero() {
+		t.Fatalf("Swap = %v, value %v", old, tm.Load())
+	}
+}
+
+//config 配置结构体中直接使用原子类型
+type config struct {
+	Enabled  atomic.Bool
+	Workers  atomic.Int32
+	Requests atomic.Int64
+	Mask     atomic.Uint32
+	Bytes    atomic.Uint64
+	Ratio    atomic.Float64
+	Timeout  atomic.Duration
+	Name     atomic.String
+	LastErr  atomic.Error
+	Started  atomic.Time
+}
+
+//TestJSON 所有类型都可以编码和解码
+func TestJSON(t *testing.T) {
+	started := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	var c config
+	c.Enabled.Store(true)
+	c.Workers.Store(-4)
+	c.Requests.Store(1 << 40)
+	c.Mask.Store(0xff)
+	c.Bytes.Store(math.MaxUint64)
+	c.Ratio.Store(0.75)
+	c.Timeout.Store(90 * time.Second)
+	c.Name.Store("order-service")
+	c.LastErr.Store(errors.New("connection refused"))
+	c.Started.Store(started)
+
+	data, err := json.Marshal(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Enabled":true,"Workers":-4,"Requests":1099511627776,"Mask":255,"Bytes":18446744073709551615,` +
+		`"Ratio":0.75,"Timeout":"1m30s","Name":"order-service","LastErr":"connection refused","Started":"2026-10-18T08:00:00Z"}`
+	if string(data) != want {
+		t.Fatalf("Marshal =\n%s\nwant\n%s", data, want)
+	}
+
+	var d config
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Enabled.Load() || d.Workers.Load() != -4 || d.Requests.Load() != 1<<40 || d.Mask.Load() != 0xff ||
+		d.Bytes.Load() != math.MaxUint64 || d.Ratio.Load() != 0.75 || d.Timeout.Load() != 90*time.Second ||
+		d.Name.Load() != "order-service" || d.LastErr.Load().Error() != "connection refused" || !d.Started.Load().Equal(started) {
+		t.Fatalf("Unmarshal = %s", mustMarshal(t, &d))
+	}
+
+	//Duration 也接受纳秒数，Error 的 null 是 nil
+	if err := json.Unmarshal([]byte(`{"Timeout":1500000000,"LastErr":null}`), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Timeout.Load() != 1500*time.Millisecond || d.LastErr.Load() != nil {
+		t.Fatalf("Timeout = %v, LastErr = %v", d.Timeout.Load(), d.LastErr.Load())
+	}
+	if err := json.Unmarshal([]byte(`{"Timeout":true}`), &d); err == nil {
+		t.Fatal("Unmarshal of a bool into Duration succeeded")
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+//TestNoCopy go vet 能发现 testdata/nocopy 中对原子类型的复制
+func TestNoCopy(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go vet")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	out, err := exec.Command(goTool, "vet", "./testdata/nocopy").CombinedOutput()
+	if err == nil {
+		t.Fatalf("go vet found nothing:\n%s", out)
+	}
+	for _, want := range []string{"byValue passes lock by value", "assignment copies lock value", "range var x copies lock"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("go vet output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+//TestSize noCopy 不占空间，原子类型和它包装的值一样大
+func TestSize(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		size, want uintptr
+	}{
+		{"Bool", unsafe.Sizeof(atomic.Bool{}), 4},
+		{"Int32", unsafe.Sizeof(atomic.Int32{}), 4},
+		{"Uint32", unsafe.Sizeof(atomic.Uint32{}), 4},
+		{"Int64", unsafe.Sizeof(atomic.Int64{}), 8},
+		{"Uint64", unsafe.Sizeof(atomic.Uint64{}), 8},
+		{"Float64", unsafe.Sizeof(atomic.Float64{}), 8},
+		{"Duration", unsafe.Sizeof(atomic.Duration{}), 8},
+	} {
+		if tt.size != tt.want {
+			t.Errorf("Sizeof(%s) = %d, want %d", tt.name, tt.size, tt.want)
+		}
+	}
+}
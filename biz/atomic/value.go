@@ -0,0 +1,228 @@
+package atomic
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+//String、Error、Time 不能放进一个机器字，保存的是指向不可变值的指针：
+//每次 Store 都分配一个新值，再原子地替换指针；nil 指针表示零值。
+//atomic.Value 直到 Go 1.17 才有 Swap 和 CompareAndSwap，所以这里直接用 unsafe.Pointer。
+
+//String 原子的 string
+type String struct {
+	_ noCopy
+	p unsafe.Pointer //*string
+}
+
+//NewString 创建初始值为 v 的 String
+func NewString(v string) *String {
+	s := &String{}
+	s.Store(v)
+	return s
+}
+
+func loadString(p unsafe.Pointer) string {
+	if p == nil {
+		return ""
+	}
+	return *(*string)(p)
+}
+
+//Load 原子读取
+func (s *String) Load() string {
+	return loadString(atomic.LoadPointer(&s.p))
+}
+
+//Store 原子写入
+func (s *String) Store(v string) {
+	atomic.StorePointer(&s.p, unsafe.Pointer(&v))
+}
+
+//Swap 写入新值，返回旧值
+func (s *String) Swap(v string) string {
+	return loadString(atomic.SwapPointer(&s.p, unsafe.Pointer(&v)))
+}
+
+//CompareAndSwap 当前值是 old 时替换为 new
+func (s *String) CompareAndSwap(old, new string) bool {
+	for {
+		p := atomic.LoadPointer(&s.p)
+		if loadString(p) != old {
+			return false
+		}
+		if atomic.CompareAndSwapPointer(&s.p, p, unsafe.Pointer(&new)) {
+			return true
+		}
+	}
+}
+
+func (s *String) String() string {
+	return s.Load()
+}
+
+//MarshalJSON 实现 json.Marshaler
+func (s *String) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Load())
+}
+
+//UnmarshalJSON 实现 json.Unmarshaler
+func (s *String) UnmarshalJSON(data []byte) error {
+	var v string
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	s.Store(v)
+	return nil
+}
+
+//Error 原子的 error
+type Error struct {
+	_ noCopy
+	p unsafe.Pointer //*errorBox
+}
+
+//errorBox 让 nil error 也有一个地址
+type errorBox struct {
+	err error
+}
+
+//NewError 创建初始值为 err 的 Error
+func NewError(err error) *Error {
+	e := &Error{}
+	e.Store(err)
+	return e
+}
+
+func loadError(p unsafe.Pointer) error {
+	if p == nil {
+		return nil
+	}
+	return (*errorBox)(p).err
+}
+
+//Load 原子读取
+func (e *Error) Load() error {
+	return loadError(atomic.LoadPointer(&e.p))
+}
+
+//Store 原子写入
+func (e *Error) Store(err error) {
+	atomic.StorePointer(&e.p, unsafe.Pointer(&errorBox{err}))
+}
+
+//Swap 写入新值，返回旧值
+func (e *Error) Swap(err error) error {
+	return loadError(atomic.SwapPointer(&e.p, unsafe.Pointer(&errorBox{err})))
+}
+
+//CompareAndSwap 当前值是 old 时替换为 new，用 == 比较，动态类型不可比较时会 panic
+func (e *Error) CompareAndSwap(old, new error) bool {
+	box := unsafe.Pointer(&errorBox{new})
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if loadError(p) != old {
+			return false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, box) {
+			return true
+		}
+	}
+}
+
+//MarshalJSON 实现 json.Marshaler，输出错误信息，nil 输出 null
+func (e *Error) MarshalJSON() ([]byte, error) {
+	err := e.Load()
+	if err == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(err.Error())
+}
+
+//UnmarshalJSON 实现 json.Unmarshaler，字符串变成 errors.New 的结果，null 变成 nil
+func (e *Error) UnmarshalJSON(data []byte) error {
+	var msg *string
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	if msg == nil {
+		e.Store(nil)
+	} else {
+		e.Store(jsonError(*msg))
+	}
+	return nil
+}
+
+//jsonError 从 JSON 读出来的错误
+type jsonError string
+
+func (e jsonError) Error() string { return string(e) }
+
+//Time 原子的 time.Time
+type Time struct {
+	_ noCopy
+	p unsafe.Pointer //*time.Time
+}
+
+//NewTime 创建初始值为 v 的 Time
+func NewTime(v time.Time) *Time {
+	t := &Time{}
+	t.Store(v)
+	return t
+}
+
+func loadTime(p unsafe.Pointer) time.Time {
+	if p == nil {
+		return time.Time{}
+	}
+	return *(*time.Time)(p)
+}
+
+//Load 原子读取
+func (t *Time) Load() time.Time {
+	return loadTime(atomic.LoadPointer(&t.p))
+}
+
+//Store 原子写入
+func (t *Time) Store(v time.Time) {
+	atomic.StorePointer(&t.p, unsafe.Pointer(&v))
+}
+
+//Swap 写入新值，返回旧值
+func (t *Time) Swap(v time.Time) time.Time {
+	return loadTime(atomic.SwapPointer(&t.p, unsafe.Pointer(&v)))
+}
+
+//CompareAndSwap 当前值和 old 是同一时刻（time.Time.Equal）时替换为 new
+func (t *Time) CompareAndSwap(old, new time.Time) bool {
+	for {
+		p := atomic.LoadPointer(&t.p)
+		if !loadTime(p).Equal(old) {
+			return false
+		}
+		if atomic.CompareAndSwapPointer(&t.p, p, unsafe.Pointer(&new)) {
+			return true
+		}
+	}
+}
+
+func (t *Time) String() string {
+	return t.Load().String()
+}
+
+//MarshalJSON 实现 json.Marshaler，格式和 time.Time 相同
+func (t *Time) MarshalJSON() ([]byte, error) {
+	return t.Load().MarshalJSON()
+}
+
+//UnmarshalJSON 实现 json.Unmarshaler
+func (t *Time) UnmarshalJSON(data []byte) error {
+	var v time.Time
+	if err := v.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	t.Store(v)
+	return nil
+}
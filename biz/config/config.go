@@ -0,0 +1,196 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ @desc 热加载的配置：atomic.Value 保存带版本号的快照，订阅者不会错过最新版本，校验失败不生效，可以回滚到上一个好的版本
+ @date 2026-10-18
+*/
+
+//atomic.ExampleAtomicValue 用 cond.Broadcast 通知读者，读者不在 cond.Wait 中的时候发生的更新就丢了，
+//它要到下一次更新才会醒来。这里每个快照都有递增的版本号，订阅者记住自己看到的版本，
+//只要当前版本比它新就立即返回，不依赖通知的时机：中间的版本可能被合并，但最新的版本一定能拿到。
+
+//Snapshot 某个版本的配置，生效之后不会再被修改
+type Snapshot struct {
+	//Version 从 1 开始递增，回滚也会产生新的版本
+	Version uint64
+	//Value 配置的值，类型和 NewHolder 的初始值相同
+	Value interface{}
+	//Source 配置的来源，比如文件路径、"rollback to v3"
+	Source string
+	//Time 生效的时间
+	Time time.Time
+}
+
+//Validator 校验新的配置，返回 error 时配置不会生效
+type Validator func(v interface{}) error
+
+//Options Holder 的配置
+type Options struct {
+	//New 返回一个新的配置值（可以带默认值），加载器把文件解码到它上面；为 nil 时使用类型的零值
+	New func() interface{}
+	//Validators 每次 Store 都会执行，配置值实现了 Validate() error 时也会先调用它
+	Validators []Validator
+	//History 为回滚保留的旧版本个数，默认 4
+	History int
+}
+
+var (
+	//ErrNoPrevious 没有可以回滚的版本
+	ErrNoPrevious = errors.New("config: no previous version to roll back to")
+)
+
+//Holder 保存当前生效的配置，Load 是无锁的，Store、Rollback 互相串行
+type Holder struct {
+	v    atomic.Value //*Snapshot
+	typ  reflect.Type
+	opts Options
+
+	mu      sync.Mutex
+	history []*Snapshot   //之前生效过的版本，最后一个是上一个版本
+	changed chan struct{} //每次生效新版本时关闭，再换一个新的
+}
+
+//NewHolder 用初始值创建 Holder，初始值的版本是 1，之后 Store 的值必须是相同的类型
+func NewHolder(initial interface{}, opts Options) (*Holder, error) {
+	if initial == nil {
+		return nil, errors.New("config: initial value must not be nil")
+	}
+	if opts.History <= 0 {
+		opts.History = 4
+	}
+	h := &Holder{typ: reflect.TypeOf(initial), opts: opts, changed: make(chan struct{})}
+	if err := h.validate(initial); err != nil {
+		return nil, err
+	}
+	h.v.Store(&Snapshot{Version: 1, Value: initial, Source: "initial", Time: time.Now()})
+	return h, nil
+}
+
+//Load 当前生效的快照
+func (h *Holder) Load() *Snapshot {
+	return h.v.Load().(*Snapshot)
+}
+
+//Value 当前生效的配置值
+func (h *Holder) Value() interface{} {
+	return h.Load().Value
+}
+
+//Version 当前生效的版本
+func (h *Holder) Version() uint64 {
+	return h.Load().Version
+}
+
+//NewValue 返回一个可以被解码的新值，见 Options.New
+func (h *Holder) NewValue() interface{} {
+	if h.opts.New != nil {
+		return h.opts.New()
+	}
+	if h.typ.Kind() == reflect.Ptr {
+		return reflect.New(h.typ.Elem()).Interface()
+	}
+	return reflect.Zero(h.typ).Interface()
+}
+
+//Store 校验并生效新的配置，返回新的快照；校验失败时当前配置不变
+func (h *Holder) Store(v interface{}, source string) (*Snapshot, error) {
+	if err := h.validate(v); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cur := h.Load()
+	h.history = append(h.history, cur)
+	if len(h.history) > h.opts.History {
+		h.history = h.history[len(h.history)-h.opts.History:]
+	}
+	return h.publish(cur, v, source), nil
+}
+
+//Rollback 把上一个版本作为新的版本重新生效，当前版本被丢弃（不能再回滚到它）
+func (h *Holder) Rollback() (*Snapshot, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.history) == 0 {
+		return nil, ErrNoPrevious
+	}
+	prev := h.history[len(h.history)-1]
+	h.history = h.history[:len(h.history)-1]
+	return h.publish(h.Load(), prev.Value, fmt.Sprintf("rollback to v%d (%s)", prev.Version, prev.Source)), nil
+}
+
+//publish 需要持有 mu
+func (h *Holder) publish(cur *Snapshot, v interface{}, source string) *Snapshot {
+	s := &Snapshot{Version: cur.Version + 1, Value: v, Source: source, Time: time.Now()}
+	h.v.Store(s)
+	close(h.changed)
+	h.changed = make(chan struct{})
+	return s
+}
+
+func (h *Holder) validate(v interface{}) error {
+	if t := reflect.TypeOf(v); t != h.typ {
+		return fmt.Errorf("config: value of type %v, want %v", t, h.typ)
+	}
+	if vv, ok := v.(interface{ Validate() error }); ok {
+		if err := vv.Validate(); err != nil {
+			return fmt.Errorf("config: invalid: %w", err)
+		}
+	}
+	for _, validate := range h.opts.Validators {
+		if err := validate(v); err != nil {
+			return fmt.Errorf("config: invalid: %w", err)
+		}
+	}
+	return nil
+}
+
+//Wait 等待比 version 新的版本，当前版本已经比 version 新时立即返回
+func (h *Holder) Wait(ctx context.Context, version uint64) (*Snapshot, error) {
+	for {
+		h.mu.Lock()
+		s, changed := h.Load(), h.changed
+		h.mu.Unlock()
+		if s.Version > version {
+			return s, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+//Subscription 订阅配置的变化，不能在多个 goroutine 中同时使用
+type Subscription struct {
+	h    *Holder
+	seen uint64
+}
+
+//Subscribe 创建订阅，第一次 Next 立即返回当前版本
+func (h *Holder) Subscribe() *Subscription {
+	return &Subscription{h: h}
+}
+
+//Next 返回比上次看到的更新的版本，没有时阻塞。
+//两次调用之间生效了多个版本时只返回最新的一个
+func (s *Subscription) Next(ctx context.Context) (*Snapshot, error) {
+	snap, err := s.h.Wait(ctx, s.seen)
+	if err != nil {
+		return nil, err
+	}
+	s.seen = snap.Version
+	return snap, nil
+}
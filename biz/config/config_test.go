@@ -0,0 +1,340 @@
+package config_test
+
+import (
+	"context"
+	"errors"
+	"go-learn.com/v1/biz/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type serverConfig struct {
+	Addr    string        `json:"addr" config:"addr"`
+	Workers int           `json:"workers"`
+	Timeout time.Duration `json:"timeout"`
+	Debug   bool          `json:"debug"`
+	Tags    []string      `json:"tags"`
+	Limits  struct {
+		QPS   float64 `json:"qps"`
+		Burst uint    `json:"burst"`
+	} `json:"limits"`
+}
+
+func (c *serverConfig) Validate() error {
+	if c.Workers <= 0 {
+		return errors.New("workers must be positive")
+	}
+	return nil
+}
+
+func newHolder(t *testing.T, opts config.Options) *config.Holder {
+	h, err := config.NewHolder(&serverConfig{Addr: ":80", Workers: 1}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+//TestStore 生效新配置版本号加一，类型不对、校验失败时当前配置不变
+func TestStore(t *testing.T) {
+	noDebug := func(v interface{}) error {
+		if v.(*serverConfig).Debug {
+			return errors.New("debug is not allowed")
+		}
+		return nil
+	}
+	h := newHolder(t, config.Options{Validators: []config.Validator{noDebug}})
+	if s := h.Load(); s.Version != 1 || s.Source != "initial" {
+		t.Fatalf("initial snapshot = %+v", s)
+	}
+
+	s, err := h.Store(&serverConfig{Addr: ":8080", Workers: 4}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Version != 2 || h.Version() != 2 || h.Value().(*serverConfig).Addr != ":8080" {
+		t.Fatalf("after Store: %+v", h.Load())
+	}
+
+	for _, bad := range []interface{}{
+		serverConfig{Workers: 1},
+		&serverConfig{Workers: 0},
+		&serverConfig{Workers: 1, Debug: true},
+	} {
+		if _, err := h.Store(bad, "bad"); err == nil {
+			t.Fatalf("Store(%+v) succeeded", bad)
+		}
+	}
+	if h.Version() != 2 {
+		t.Fatalf("Version = %d after failed stores, want 2", h.Version())
+	}
+
+	if _, err := config.NewHolder(&serverConfig{}, config.Options{}); err == nil {
+		t.Fatal("NewHolder accepted an invalid initial value")
+	}
+}
+
+//TestRollback 回滚产生新的版本，值是上一个版本的；没有旧版本时返回 ErrNoPrevious
+func TestRollback(t *testing.T) {
+	h := newHolder(t, config.Options{History: 2})
+	for i := 2; i <= 4; i++ {
+		if _, err := h.Store(&serverConfig{Workers: i}, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//只保留了 2 个旧版本：workers=3、workers=2
+	for _, want := range []int{3, 2} {
+		s, err := h.Rollback()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Value.(*serverConfig).Workers; got != want {
+			t.Fatalf("rolled back to workers=%d, want %d", got, want)
+		}
+		if !strings.HasPrefix(s.Source, "rollback to v") {
+			t.Fatalf("Source = %q", s.Source)
+		}
+	}
+	if _, err := h.Rollback(); err != config.ErrNoPrevious {
+		t.Fatalf("Rollback = %v, want ErrNoPrevious", err)
+	}
+	if h.Version() != 6 {
+		t.Fatalf("Version = %d, want 6", h.Version())
+	}
+}
+
+//TestSubscribe 并发更新时订阅者可能跳过中间的版本，但最后一定看到最新的版本
+func TestSubscribe(t *testing.T) {
+	const writers, stores = 4, 200
+	h := newHolder(t, config.Options{})
+	last := uint64(1 + writers*stores)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var subscribers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		subscribers.Add(1)
+		go func() {
+			defer subscribers.Done()
+			sub := h.Subscribe()
+			var prev uint64
+			for prev < last {
+				s, err := sub.Next(ctx)
+				if err != nil {
+					t.Errorf("Next: %v (last seen v%d)", err, prev)
+					return
+				}
+				if s.Version <= prev {
+					t.Errorf("Next returned v%d after v%d", s.Version, prev)
+					return
+				}
+				prev = s.Version
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < stores; i++ {
+				if _, err := h.Store(&serverConfig{Workers: i + 1}, "test"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	subscribers.Wait()
+}
+
+//TestWait 当前版本已经更新时立即返回，否则等到 ctx 超时
+func TestWait(t *testing.T) {
+	h := newHolder(t, config.Options{})
+	if s, err := h.Wait(context.Background(), 0); err != nil || s.Version != 1 {
+		t.Fatalf("Wait(0) = %v, %v", s, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := h.Wait(ctx, 1); err != context.DeadlineExceeded {
+		t.Fatalf("Wait(1) = %v, want DeadlineExceeded", err)
+	}
+}
+
+func tempFile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, name)
+	writeFile(t, path, content)
+	return path
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//TestFileLoader JSON、key=value 文件都能加载；内容不变时不产生新版本，内容非法时当前配置不变
+func TestFileLoader(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		path := tempFile(t, "server.json", `{"addr": ":8080", "workers": 8, "timeout": 1000000000, "limits": {"qps": 1.5}}`)
+		h := newHolder(t, config.Options{})
+		l := &config.FileLoader{Path: path, Holder: h}
+		s, err := l.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := s.Value.(*serverConfig)
+		if c.Addr != ":8080" || c.Workers != 8 || c.Timeout != time.Second || c.Limits.QPS != 1.5 || s.Source != path {
+			t.Fatalf("loaded %+v from %s", c, s.Source)
+		}
+		if s, err := l.Load(); s != nil || err != nil {
+			t.Fatalf("reloading unchanged file = %v, %v", s, err)
+		}
+
+		writeFile(t, path, `{"addr": ":9090", "workers": 0}`)
+		if _, err := l.Load(); err == nil {
+			t.Fatal("invalid config was loaded")
+		}
+		writeFile(t, path, `{"addr": ":9090", "workerz": 2}`)
+		if _, err := l.Load(); err == nil {
+			t.Fatal("unknown field was accepted")
+		}
+		if h.Version() != 2 || h.Value().(*serverConfig).Addr != ":8080" {
+			t.Fatalf("bad file changed the config: %+v", h.Load())
+		}
+	})
+
+	t.Run("keyvalue", func(t *testing.T) {
+		path := tempFile(t, "server.conf", strings.Join([]string{
+			"# server",
+			"addr = \":8080 \"",
+			"; workers",
+			"WORKERS=0x10",
+			"timeout=1m30s",
+			"debug=true",
+			"tags=a, b,,c",
+			"",
+			"limits.qps=2.5",
+			"limits.burst=10",
+		}, "\n"))
+		h := newHolder(t, config.Options{})
+		s, err := (&config.FileLoader{Path: path, Holder: h}).Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := s.Value.(*serverConfig)
+		if c.Addr != ":8080 " || c.Workers != 16 || c.Timeout != 90*time.Second || !c.Debug ||
+			!reflect.DeepEqual(c.Tags, []string{"a", "b", "c"}) || c.Limits.QPS != 2.5 || c.Limits.Burst != 10 {
+			t.Fatalf("loaded %+v", c)
+		}
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		//配置类型不是指针，文件里没有的字段使用 Options.New 的默认值
+		type limits struct {
+			QPS   int
+			Burst int
+		}
+		path := tempFile(t, "limits.conf", "qps=100")
+		h, err := config.NewHolder(limits{}, config.Options{New: func() interface{} { return limits{Burst: 5} }})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := (&config.FileLoader{Path: path, Holder: h}).Load(); err != nil {
+			t.Fatal(err)
+		}
+		if got := h.Value().(limits); got != (limits{QPS: 100, Burst: 5}) {
+			t.Fatalf("loaded %+v", got)
+		}
+	})
+}
+
+//TestFileLoaderRun Run 发现文件的变化并生效，错误通过 OnError 报告
+func TestFileLoaderRun(t *testing.T) {
+	path := tempFile(t, "server.conf", "workers=2")
+	h := newHolder(t, config.Options{})
+	errs := make(chan error, 10)
+	l := &config.FileLoader{Path: path, Holder: h, Interval: 5 * time.Millisecond, OnError: func(err error) { errs <- err }}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Run(ctx) }()
+
+	sub := h.Subscribe()
+	wait := func(workers int) {
+		t.Helper()
+		wctx, wcancel := context.WithTimeout(ctx, 5*time.Second)
+		defer wcancel()
+		for {
+			s, err := sub.Next(wctx)
+			if err != nil {
+				t.Fatalf("waiting for workers=%d: %v", workers, err)
+			}
+			if s.Value.(*serverConfig).Workers == workers {
+				return
+			}
+		}
+	}
+	wait(2)
+
+	writeFile(t, path, "workers=-1")
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "workers must be positive") {
+			t.Fatalf("OnError(%v)", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnError was not called for an invalid file")
+	}
+
+	writeFile(t, path, "workers=3")
+	wait(3)
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Run = %v, want Canceled", err)
+	}
+}
+
+//TestKeyValueErrors 格式错误、未知的 key、类型不对时报错，错误里带行号
+func TestKeyValueErrors(t *testing.T) {
+	for _, tt := range []struct {
+		data, want string
+	}{
+		{"addr", "line 1: want key=value"},
+		{"# ok\nport=80", "line 2: port: unknown key"},
+		{"workers=many", "line 1: workers"},
+		{"timeout=10", "line 1: timeout"},
+		{"limits.rate=1", "limits.rate: unknown key"},
+		{`addr="unterminated`, "bad quoted value"},
+	} {
+		var c serverConfig
+		err := config.KeyValue([]byte(tt.data), &c)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("KeyValue(%q) = %v, want error containing %q", tt.data, err, tt.want)
+		}
+	}
+
+	m := map[string]string{}
+	if err := config.KeyValue([]byte("a.b = 1\nc=\"x y\""), &m); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, map[string]string{"a.b": "1", "c": "x y"}) {
+		t.Fatalf("map = %v", m)
+	}
+}
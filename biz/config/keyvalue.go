@@ -0,0 +1,157 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//KeyValue 解码 key=value 格式：# 和 ; 开头的行是注释，空行忽略。
+//key 对应结构体字段的 config 标签，没有标签时不区分大小写地匹配字段名，a.b=1 设置嵌套结构体 a 的字段 b。
+//value 两边的空白会被去掉，用双引号括起来时按 Go 字符串解析，
+//支持 string、bool、整数、浮点数、time.Duration 和逗号分隔的 []string。
+//v 也可以是 *map[string]string。未知的 key 会报错，避免拼错的配置被悄悄忽略
+func KeyValue(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("key=value: decode into non-pointer %T", v)
+	}
+	rv = rv.Elem()
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' || text[0] == ';' {
+			continue
+		}
+		i := strings.IndexByte(text, '=')
+		if i <= 0 {
+			return fmt.Errorf("key=value: line %d: want key=value, got %q", line, text)
+		}
+		key, value := strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+		if strings.HasPrefix(value, `"`) {
+			s, err := strconv.Unquote(value)
+			if err != nil {
+				return fmt.Errorf("key=value: line %d: bad quoted value %s", line, value)
+			}
+			value = s
+		}
+		if err := setKey(rv, key, value); err != nil {
+			return fmt.Errorf("key=value: line %d: %s: %v", line, key, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func setKey(rv reflect.Value, key, value string) error {
+	if rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String && rv.Type().Elem().Kind() == reflect.String {
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+		rv.SetMapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()), reflect.ValueOf(value).Convert(rv.Type().Elem()))
+		return nil
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot set a key on %v", rv.Type())
+	}
+
+	name, rest := key, ""
+	if i := strings.IndexByte(key, '.'); i >= 0 {
+		name, rest = key[:i], key[i+1:]
+	}
+	field, ok := findField(rv, name)
+	if !ok {
+		return errors.New("unknown key")
+	}
+	if rest != "" {
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				field.Set(reflect.New(field.Type().Elem()))
+			}
+			field = field.Elem()
+		}
+		return setKey(field, rest, value)
+	}
+	return setValue(field, value)
+}
+
+//findField 先按 config 标签找，再不区分大小写地按字段名找，只考虑导出的字段
+func findField(rv reflect.Value, name string) (reflect.Value, bool) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.PkgPath == "" && f.Tag.Get("config") == name {
+			return rv.Field(i), true
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.PkgPath == "" && f.Tag.Get("config") == "" && strings.EqualFold(f.Name, name) {
+			return rv.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setValue(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %v", field.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		s := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			s.Index(i).SetString(item)
+		}
+		field.Set(s)
+	default:
+		return fmt.Errorf("unsupported type %v", field.Type())
+	}
+	return nil
+}
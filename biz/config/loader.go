@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//Decoder 把文件内容解码到 v 上，v 是指针
+type Decoder func(data []byte, v interface{}) error
+
+//JSON 用 encoding/json 解码，未知的字段报错
+func JSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+//DecoderFor 按扩展名选择解码器：.json 使用 JSON，其他使用 KeyValue
+func DecoderFor(path string) Decoder {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return JSON
+	}
+	return KeyValue
+}
+
+//FileLoader 定期读取文件，内容变化时解码、校验并生效
+type FileLoader struct {
+	Path   string
+	Holder *Holder
+	//Decode 为 nil 时按 DecoderFor(Path) 选择
+	Decode Decoder
+	//Interval 检查文件的间隔，默认 1 秒
+	Interval time.Duration
+	//OnError Run 中读取、解码、校验失败时的回调，当前配置保持不变
+	OnError func(err error)
+
+	last []byte //上一次读到的内容（不管有没有生效），没有变化就不再重复解码和报错
+}
+
+//Load 读取一次文件，内容有变化并且生效时返回新的快照，没有变化时返回 nil
+func (l *FileLoader) Load() (*Snapshot, error) {
+	data, err := ioutil.ReadFile(l.Path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+	if l.last != nil && bytes.Equal(data, l.last) {
+		return nil, nil
+	}
+	l.last = data
+
+	decode := l.Decode
+	if decode == nil {
+		decode = DecoderFor(l.Path)
+	}
+	v, err := l.decode(decode, data)
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %w", l.Path, err)
+	}
+	return l.Holder.Store(v, l.Path)
+}
+
+//decode 解码到 Holder.NewValue 上，配置类型不是指针时先取地址再解码
+func (l *FileLoader) decode(decode Decoder, data []byte) (interface{}, error) {
+	v := l.Holder.NewValue()
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		return v, decode(data, v)
+	}
+	p := reflect.New(rv.Type())
+	p.Elem().Set(rv)
+	if err := decode(data, p.Interface()); err != nil {
+		return nil, err
+	}
+	return p.Elem().Interface(), nil
+}
+
+//Run 立即加载一次，之后每隔 Interval 检查一次，直到 ctx 被取消
+func (l *FileLoader) Run(ctx context.Context) error {
+	interval := l.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastErr string //同样的错误只报告一次，比如文件一直不存在
+	for {
+		if _, err := l.Load(); err != nil {
+			if err.Error() != lastErr && l.OnError != nil {
+				l.OnError(err)
+			}
+			lastErr = err.Error()
+		} else {
+			lastErr = ""
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
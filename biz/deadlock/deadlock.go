@@ -0,0 +1,141 @@
+package deadlock
+
+import (
+	"fmt"
+	"go-learn.com/v1/biz/internal/goid"
+	"os"
+	"sync"
+	"time"
+)
+
+/**
+ @desc 运行时死锁检测：记录全局的加锁顺序图，发现环路等待或者等锁超时就报告双方的调用栈
+ @date 2026-10-18
+*/
+
+//race.Deadlock() 中两个 goroutine 以相反的顺序获取 psCertificate 和 propertyCertificate，
+//这正是死锁第4个条件"环路等待"。这里把每次"持有 A 的时候去获取 B"记录成图中的一条边 A->B，
+//如果某个 goroutine 持有 B 又去获取 A，而图中已经能从 A 走到 B，就说明存在环，即使这次运气好没有真正卡住也会报告出来。
+
+//Opts 检测器的配置，需要在使用锁之前设置，运行过程中不要修改
+var Opts = struct {
+	//关闭检测，锁退化成普通的锁
+	Disable bool
+	//关闭加锁顺序检测，只保留等锁超时检测
+	DisableLockOrder bool
+	//等待锁超过 Timeout 就报告，0 表示不检测
+	Timeout time.Duration
+	//检测到问题时的回调，默认打印到 stderr
+	OnReport func(r *Report)
+}{
+	Timeout:  30 * time.Second,
+	OnReport: func(r *Report) { fmt.Fprintln(os.Stderr, r) },
+}
+
+//Mutex 可以直接替换 sync.Mutex，零值可用
+type Mutex struct {
+	mu    sync.Mutex
+	state lockState
+}
+
+//Lock 获取锁
+func (m *Mutex) Lock() {
+	lock(m, &m.state, m.mu.Lock, false, 2)
+}
+
+//Unlock 释放锁
+func (m *Mutex) Unlock() {
+	unlock(m, &m.state, false)
+	m.mu.Unlock()
+}
+
+//RWMutex 可以直接替换 sync.RWMutex，零值可用
+type RWMutex struct {
+	mu    sync.RWMutex
+	state lockState
+}
+
+//Lock 获取写锁
+func (m *RWMutex) Lock() {
+	lock(m, &m.state, m.mu.Lock, false, 2)
+}
+
+//Unlock 释放写锁
+func (m *RWMutex) Unlock() {
+	unlock(m, &m.state, false)
+	m.mu.Unlock()
+}
+
+//RLock 获取读锁
+func (m *RWMutex) RLock() {
+	lock(m, &m.state, m.mu.RLock, true, 2)
+}
+
+//RUnlock 释放读锁
+func (m *RWMutex) RUnlock() {
+	unlock(m, &m.state, true)
+	m.mu.RUnlock()
+}
+
+//RLocker 返回一个使用读锁的 sync.Locker
+func (m *RWMutex) RLocker() sync.Locker {
+	return (*rlocker)(m)
+}
+
+type rlocker RWMutex
+
+func (r *rlocker) Lock()   { lock((*RWMutex)(r), &r.state, r.mu.RLock, true, 2) }
+func (r *rlocker) Unlock() { (*RWMutex)(r).RUnlock() }
+
+//Locker 包装任意一个 sync.Locker，name 会出现在报告中
+type Locker struct {
+	l     sync.Locker
+	name  string
+	state lockState
+}
+
+//Wrap 包装一个已有的 sync.Locker
+func Wrap(l sync.Locker, name string) *Locker {
+	d.setName(l, name)
+	return &Locker{l: l, name: name}
+}
+
+//Lock 获取锁
+func (l *Locker) Lock() {
+	lock(l.l, &l.state, l.l.Lock, false, 2)
+}
+
+//Unlock 释放锁
+func (l *Locker) Unlock() {
+	unlock(l.l, &l.state, false)
+	l.l.Unlock()
+}
+
+//lock 加锁前检查重入和加锁顺序，并登记等待交给 watchdog 检查超时，拿到锁之后记录持有信息
+func lock(key interface{}, st *lockState, lockFn func(), shared bool, skip int) {
+	if Opts.Disable {
+		lockFn()
+		return
+	}
+
+	a := &acquire{key: key, state: st, gid: goid.Get(), shared: shared, stack: callers(skip + 1)}
+	if Opts.Timeout > 0 {
+		a.deadline = time.Now().Add(Opts.Timeout).UnixNano()
+	}
+	d.beforeLock(a)
+	lockFn()
+	d.afterLock(a)
+}
+
+//unlock 释放锁之前清除持有信息，避免和下一个持有者的记录交错
+//互斥锁的持有者记录在锁自己的状态里，只有读锁需要当前的 goroutine id
+func unlock(key interface{}, st *lockState, shared bool) {
+	if Opts.Disable {
+		return
+	}
+	if shared {
+		d.unlockShared(goid.Get(), key)
+	} else {
+		d.unlockExclusive(st)
+	}
+}
@@ -0,0 +1,211 @@
+package deadlock_test
+
+import (
+	"go-learn.com/v1/biz/deadlock"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//collect 替换 Opts.OnReport 收集报告，返回恢复函数
+func collect(t *testing.T) (func() []*deadlock.Report, func()) {
+	var mu sync.Mutex
+	var reports []*deadlock.Report
+	old := deadlock.Opts
+	deadlock.Opts.OnReport = func(r *deadlock.Report) {
+		mu.Lock()
+		reports = append(reports, r)
+		mu.Unlock()
+	}
+	get := func() []*deadlock.Report {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*deadlock.Report(nil), reports...)
+	}
+	return get, func() { deadlock.Opts = old }
+}
+
+//TestLockOrder race.Deadlock() 的场景：两个 goroutine 以相反的顺序加锁，即使没有真正卡住也要报告
+func TestLockOrder(t *testing.T) {
+	reports, restore := collect(t)
+	defer restore()
+
+	var psCertificate, propertyCertificate deadlock.Mutex
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		psCertificate.Lock()
+		propertyCertificate.Lock()
+		propertyCertificate.Unlock()
+		psCertificate.Unlock()
+	}()
+	<-done
+
+	propertyCertificate.Lock()
+	psCertificate.Lock()
+	psCertificate.Unlock()
+	propertyCertificate.Unlock()
+
+	rs := reports()
+	if len(rs) != 1 || rs[0].Kind != deadlock.LockOrder {
+		t.Fatalf("reports = %v, want one LockOrder", rs)
+	}
+	r := rs[0]
+	if r.Goroutine == r.OtherGoroutine || len(r.Stack) == 0 || len(r.OtherStack) == 0 {
+		t.Fatalf("report lacks both goroutines' stacks: %+v", r)
+	}
+	if s := r.String(); !strings.Contains(s, "TestLockOrder") {
+		t.Fatalf("report does not point at the test:\n%s", s)
+	}
+}
+
+//TestConsistentOrder 顺序一致时不报告
+func TestConsistentOrder(t *testing.T) {
+	reports, restore := collect(t)
+	defer restore()
+
+	var a deadlock.Mutex
+	var b deadlock.RWMutex
+	c := deadlock.Wrap(&sync.Mutex{}, "c")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				a.Lock()
+				b.RLock()
+				c.Lock()
+				c.Unlock()
+				b.RUnlock()
+				a.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if rs := reports(); len(rs) != 0 {
+		t.Fatalf("unexpected reports: %v", rs)
+	}
+}
+
+//TestLockCycle 三把锁形成的环
+func TestLockCycle(t *testing.T) {
+	reports, restore := collect(t)
+	defer restore()
+
+	a := deadlock.Wrap(&sync.Mutex{}, "a")
+	b := deadlock.Wrap(&sync.Mutex{}, "b")
+	c := deadlock.Wrap(&sync.Mutex{}, "c")
+	pair := func(x, y sync.Locker) {
+		x.Lock()
+		y.Lock()
+		y.Unlock()
+		x.Unlock()
+	}
+	pair(a, b)
+	pair(b, c)
+	pair(c, a)
+
+	rs := reports()
+	if len(rs) != 1 || rs[0].Kind != deadlock.LockOrder || rs[0].Lock != "a" || rs[0].Held != "c" {
+		t.Fatalf("reports = %v, want a/c LockOrder", rs)
+	}
+}
+
+//TestRecursive 同一个 goroutine 重复获取写锁或者读锁
+func TestRecursive(t *testing.T) {
+	reports, restore := collect(t)
+	defer restore()
+
+	var mu deadlock.Mutex
+	locked := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		mu.Lock()
+		close(locked)
+		mu.Lock() //重入，会一直阻塞到其他 goroutine 释放
+		close(done)
+	}()
+	<-locked
+	for len(reports()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	mu.Unlock()
+	<-done
+	mu.Unlock()
+
+	if rs := reports(); rs[0].Kind != deadlock.Recursive {
+		t.Fatalf("reports = %v, want Recursive", rs)
+	}
+
+	//读锁重入也要报告：两次 RLock 之间有写者排队就会死锁
+	var rw deadlock.RWMutex
+	rw.RLock()
+	rw.RLock()
+	rw.RUnlock()
+	rw.RUnlock()
+	if rs := reports(); len(rs) != 2 || rs[1].Kind != deadlock.Recursive {
+		t.Fatalf("reports = %v, want RLock reentry reported as Recursive", rs)
+	}
+}
+
+//TestLockTimeout 等锁超时报告持有者的调用栈
+func TestLockTimeout(t *testing.T) {
+	reports, restore := collect(t)
+	defer restore()
+	deadlock.Opts.Timeout = 20 * time.Millisecond
+
+	var mu deadlock.Mutex
+	mu.Lock()
+	done := make(chan struct{})
+	go func() {
+		mu.Lock()
+		mu.Unlock()
+		close(done)
+	}()
+	for len(reports()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	mu.Unlock()
+	<-done
+
+	r := reports()[0]
+	if r.Kind != deadlock.LockTimeout || len(r.OtherStack) == 0 || r.Goroutine == r.OtherGoroutine {
+		t.Fatalf("report = %+v, want LockTimeout with holder stack", r)
+	}
+}
+
+//BenchmarkMutex 和 sync.Mutex 对比加锁、解锁一次的开销，每个 goroutine 使用自己的锁
+func BenchmarkMutex(b *testing.B) {
+	b.Run("sync", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			var mu sync.Mutex
+			for pb.Next() {
+				mu.Lock()
+				mu.Unlock()
+			}
+		})
+	})
+	b.Run("deadlock", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			var mu deadlock.Mutex
+			for pb.Next() {
+				mu.Lock()
+				mu.Unlock()
+			}
+		})
+	})
+	b.Run("deadlock-nested", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			var outer, inner deadlock.Mutex
+			for pb.Next() {
+				outer.Lock()
+				inner.Lock()
+				inner.Unlock()
+				outer.Unlock()
+			}
+		})
+	})
+}
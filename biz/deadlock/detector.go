@@ -0,0 +1,435 @@
+package deadlock
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//ReportKind 报告的类型
+type ReportKind int
+
+const (
+	//LockOrder 加锁顺序出现环路
+	LockOrder ReportKind = iota
+	//LockTimeout 等待锁超时
+	LockTimeout
+	//Recursive 同一个 goroutine 重复获取同一把锁，包括读锁重入
+	Recursive
+)
+
+func (k ReportKind) String() string {
+	switch k {
+	case LockOrder:
+		return "inconsistent lock order"
+	case LockTimeout:
+		return "lock wait timeout"
+	case Recursive:
+		return "recursive locking"
+	}
+	return "ReportKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+//Report 一次检测结果，包含双方 goroutine 的调用栈
+type Report struct {
+	Kind ReportKind
+	//正在获取的锁
+	Lock string
+	//当前 goroutine 已经持有的、与 Lock 形成环的锁（LockOrder/Recursive）
+	Held string
+
+	//当前 goroutine 以及获取 Lock 的位置
+	Goroutine int64
+	Stack     []uintptr
+	//另一方：LockOrder 时是以相反顺序加锁的 goroutine，LockTimeout 时是当前的持有者
+	OtherGoroutine int64
+	OtherStack     []uintptr
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "POTENTIAL DEADLOCK: %s\n", r.Kind)
+	switch r.Kind {
+	case LockOrder:
+		fmt.Fprintf(&b, "goroutine %d holds %s and is acquiring %s:\n", r.Goroutine, r.Held, r.Lock)
+		writeStack(&b, r.Stack)
+		fmt.Fprintf(&b, "goroutine %d previously locked in the opposite order (from %s towards %s):\n", r.OtherGoroutine, r.Lock, r.Held)
+		writeStack(&b, r.OtherStack)
+	case LockTimeout:
+		fmt.Fprintf(&b, "goroutine %d is waiting for %s:\n", r.Goroutine, r.Lock)
+		writeStack(&b, r.Stack)
+		if r.OtherStack != nil {
+			fmt.Fprintf(&b, "goroutine %d holds %s, acquired at:\n", r.OtherGoroutine, r.Lock)
+			writeStack(&b, r.OtherStack)
+		}
+	case Recursive:
+		fmt.Fprintf(&b, "goroutine %d is acquiring %s again:\n", r.Goroutine, r.Lock)
+		writeStack(&b, r.Stack)
+		fmt.Fprintf(&b, "previously acquired at:\n")
+		writeStack(&b, r.OtherStack)
+	}
+	return b.String()
+}
+
+func writeStack(b *strings.Builder, pcs []uintptr) {
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(b, "\t%s\n\t\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+}
+
+//acquire 一次加锁记录
+type acquire struct {
+	key    interface{}
+	state  *lockState
+	gid    int64
+	shared bool
+	stack  []uintptr
+	//等锁的截止时间（UnixNano），0 表示不检测超时
+	deadline int64
+	//已经报告过超时，由 watchdog 在分片锁下读写
+	timedOut bool
+}
+
+//lockState 每把锁自己的状态，释放互斥锁时直接从这里找到持有者，不用查全局的表，也不用再取一次 goroutine id
+type lockState struct {
+	mu     sync.Mutex
+	holder *acquire
+}
+
+//edge 持有 from 的时候获取了 to
+type edge struct {
+	from, to interface{}
+}
+
+//goroutine 一个 goroutine 持有的锁（按加锁顺序排列）和正在等待的锁
+type goroutine struct {
+	held    []*acquire
+	waiting *acquire
+}
+
+//shards 按 goroutine id 分片，不同 goroutine 加锁、解锁时互不竞争
+const shards = 64
+
+type shard struct {
+	mu         sync.Mutex
+	goroutines map[int64]*goroutine
+}
+
+//全局的检测器
+var d = newDetector()
+
+//detector 维护每个 goroutine 持有的锁和全局的加锁顺序图
+//注意：顺序图中的锁不会被删除，适合锁数量有限（全局变量、长生命周期对象）的场景
+type detector struct {
+	//所有等锁超时由一个 watchdog goroutine 检查，nextWake 是它下一次醒来的时间，放在开头保证 64 位对齐
+	nextWake  int64
+	watchOnce sync.Once
+	kick      chan struct{}
+
+	shards [shards]shard
+
+	//顺序图只有出现新的边时才加写锁，已有的边只需要读锁
+	graphMu sync.RWMutex
+	//顺序图中每条边第一次出现时，获取 to 的记录
+	order map[edge]*acquire
+	//邻接表
+	next map[interface{}][]interface{}
+
+	namesMu sync.RWMutex
+	names   map[interface{}]string
+}
+
+func newDetector() *detector {
+	d := &detector{
+		order: make(map[edge]*acquire),
+		next:  make(map[interface{}][]interface{}),
+		names: make(map[interface{}]string),
+		kick:  make(chan struct{}, 1),
+	}
+	for i := range d.shards {
+		d.shards[i].goroutines = make(map[int64]*goroutine)
+	}
+	return d
+}
+
+func (d *detector) shard(gid int64) *shard {
+	return &d.shards[uint64(gid)%shards]
+}
+
+func (d *detector) setName(key interface{}, name string) {
+	d.namesMu.Lock()
+	d.names[key] = name
+	d.namesMu.Unlock()
+}
+
+func (d *detector) name(key interface{}) string {
+	d.namesMu.RLock()
+	n, ok := d.names[key]
+	d.namesMu.RUnlock()
+	if ok {
+		return n
+	}
+	return fmt.Sprintf("%T(%p)", key, key)
+}
+
+//beforeLock 检查重入和加锁顺序，需要检测超时的时候登记为等待中
+func (d *detector) beforeLock(a *acquire) {
+	s := d.shard(a.gid)
+	s.mu.Lock()
+	g := s.goroutines[a.gid]
+	if g == nil && a.deadline != 0 {
+		g = &goroutine{}
+		s.goroutines[a.gid] = g
+	}
+	var held []*acquire
+	if g != nil {
+		//其他 goroutine 释放互斥锁时会修改 g.held，所以复制一份
+		held = append(held, g.held...)
+		if a.deadline != 0 {
+			g.waiting = a
+		}
+	}
+	s.mu.Unlock()
+	if a.deadline != 0 {
+		d.watch(a)
+	}
+
+	var reports []*Report
+	for _, h := range held {
+		if h.key == a.key {
+			//写锁重入一定会死锁；读锁重入在有写者等待时也会：写者在等第一次的读锁释放，第二次 RLock 又排在写者后面
+			reports = append(reports, &Report{
+				Kind: Recursive, Lock: d.name(a.key), Held: d.name(a.key),
+				Goroutine: a.gid, Stack: a.stack,
+				OtherGoroutine: a.gid, OtherStack: h.stack,
+			})
+			continue
+		}
+		//顺序图里已经有 h.key -> key 的话，加入这条边的时候就检查过环了
+		if Opts.DisableLockOrder || d.hasEdge(h.key, a.key) {
+			continue
+		}
+		//已经存在 key -> ... -> h.key 的路径，再加上 h.key -> key 就成环了
+		d.graphMu.RLock()
+		first := d.path(a.key, h.key)
+		d.graphMu.RUnlock()
+		if first != nil {
+			reports = append(reports, &Report{
+				Kind: LockOrder, Lock: d.name(a.key), Held: d.name(h.key),
+				Goroutine: a.gid, Stack: a.stack,
+				OtherGoroutine: first.gid, OtherStack: first.stack,
+			})
+		}
+	}
+
+	for _, r := range reports {
+		Opts.OnReport(r)
+	}
+}
+
+func (d *detector) hasEdge(from, to interface{}) bool {
+	d.graphMu.RLock()
+	_, ok := d.order[edge{from, to}]
+	d.graphMu.RUnlock()
+	return ok
+}
+
+//path 在顺序图中查找 from 到 to 的路径，返回路径上第一条边的记录，调用者持有 graphMu
+func (d *detector) path(from, to interface{}) *acquire {
+	visited := map[interface{}]bool{from: true}
+	var dfs func(n interface{}) bool
+	dfs = func(n interface{}) bool {
+		if n == to {
+			return true
+		}
+		for _, m := range d.next[n] {
+			if !visited[m] {
+				visited[m] = true
+				if dfs(m) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for _, n := range d.next[from] {
+		visited[n] = true
+		if dfs(n) {
+			return d.order[edge{from, n}]
+		}
+	}
+	return nil
+}
+
+//afterLock 记录持有信息，并把已持有的锁到 key 的边加入顺序图
+func (d *detector) afterLock(a *acquire) {
+	s := d.shard(a.gid)
+	s.mu.Lock()
+	g := s.goroutines[a.gid]
+	if g == nil {
+		g = &goroutine{}
+		s.goroutines[a.gid] = g
+	}
+	g.waiting = nil
+	var held []*acquire
+	if !Opts.DisableLockOrder {
+		held = append(held, g.held...)
+	}
+	g.held = append(g.held, a)
+	s.mu.Unlock()
+
+	if !a.shared {
+		a.state.mu.Lock()
+		a.state.holder = a
+		a.state.mu.Unlock()
+	}
+
+	for _, h := range held {
+		if h.key == a.key || d.hasEdge(h.key, a.key) {
+			continue
+		}
+		e := edge{h.key, a.key}
+		d.graphMu.Lock()
+		if _, ok := d.order[e]; !ok {
+			d.order[e] = a
+			d.next[h.key] = append(d.next[h.key], a.key)
+		}
+		d.graphMu.Unlock()
+	}
+}
+
+//unlockExclusive 清除互斥锁的持有信息，互斥锁可以由其他 goroutine 释放，所以按持有者查找
+func (d *detector) unlockExclusive(st *lockState) {
+	st.mu.Lock()
+	a := st.holder
+	st.holder = nil
+	st.mu.Unlock()
+	if a != nil {
+		d.removeHeld(a.gid, func(h *acquire) bool { return h == a })
+	}
+}
+
+//unlockShared 清除读锁的持有信息，读锁也可能由其他 goroutine 释放
+func (d *detector) unlockShared(gid int64, key interface{}) {
+	match := func(h *acquire) bool { return h.key == key && h.shared }
+	if d.removeHeld(gid, match) {
+		return
+	}
+	for i := range d.shards {
+		s := &d.shards[i]
+		s.mu.Lock()
+		var other []int64
+		for g := range s.goroutines {
+			other = append(other, g)
+		}
+		s.mu.Unlock()
+		for _, g := range other {
+			if d.removeHeld(g, match) {
+				return
+			}
+		}
+	}
+}
+
+//removeHeld 从 gid 持有的锁中删除最后一个满足 match 的记录
+func (d *detector) removeHeld(gid int64, match func(h *acquire) bool) bool {
+	s := d.shard(gid)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.goroutines[gid]
+	if g == nil {
+		return false
+	}
+	for i := len(g.held) - 1; i >= 0; i-- {
+		if match(g.held[i]) {
+			g.held = append(g.held[:i], g.held[i+1:]...)
+			if len(g.held) == 0 && g.waiting == nil {
+				delete(s.goroutines, gid)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+//watch 登记了一个带截止时间的等待，截止时间早于 watchdog 下一次醒来的时间就叫醒它
+func (d *detector) watch(a *acquire) {
+	d.watchOnce.Do(func() { go d.watchdog() })
+	if a.deadline < atomic.LoadInt64(&d.nextWake) {
+		select {
+		case d.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+//watchdog 代替每次加锁一个 time.AfterFunc：定期扫描所有等待中的 goroutine，报告超时的等待，
+//然后睡到最早的截止时间（最多一秒）或者被 watch 叫醒
+func (d *detector) watchdog() {
+	for {
+		//扫描期间登记的等待一律叫醒 watchdog，避免漏掉比这次计算出的 nextWake 更早的截止时间
+		atomic.StoreInt64(&d.nextWake, math.MaxInt64)
+		now := time.Now().UnixNano()
+		wake := now + int64(time.Second)
+		var timeouts []*acquire
+		for i := range d.shards {
+			s := &d.shards[i]
+			s.mu.Lock()
+			for _, g := range s.goroutines {
+				w := g.waiting
+				if w == nil || w.timedOut {
+					continue
+				}
+				if w.deadline <= now {
+					w.timedOut = true
+					timeouts = append(timeouts, w)
+				} else if w.deadline < wake {
+					wake = w.deadline
+				}
+			}
+			s.mu.Unlock()
+		}
+		atomic.StoreInt64(&d.nextWake, wake)
+
+		for _, w := range timeouts {
+			d.lockTimeout(w)
+		}
+
+		timer := time.NewTimer(time.Duration(wake - now))
+		select {
+		case <-timer.C:
+		case <-d.kick:
+			timer.Stop()
+		}
+	}
+}
+
+//lockTimeout 等锁超时，报告当前的持有者
+func (d *detector) lockTimeout(w *acquire) {
+	r := &Report{Kind: LockTimeout, Lock: d.name(w.key), Goroutine: w.gid, Stack: w.stack}
+	w.state.mu.Lock()
+	if a := w.state.holder; a != nil {
+		r.OtherGoroutine, r.OtherStack = a.gid, a.stack
+	}
+	w.state.mu.Unlock()
+
+	Opts.OnReport(r)
+}
+
+func callers(skip int) []uintptr {
+	var pcs [32]uintptr
+	n := runtime.Callers(skip+1, pcs[:])
+	return append([]uintptr(nil), pcs[:n]...)
+}
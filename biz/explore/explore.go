@@ -0,0 +1,398 @@
+package explore
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+ @desc 确定性的交错探索（模型检查）：同一时刻只让一个 goroutine 运行，在包装过的原语处切换，枚举或者随机选择调度，并且可以精确重放
+ @date 2026-10-18
+*/
+
+//stress 包靠运气：出问题的交错可能一百万次才碰到一次，碰到了也没法重现。
+//这里场景中的每个 goroutine（下面叫线程）只在 Mutex、Chan、Int64、Value、Var 的操作之前让出，
+//由调度器决定下一个运行哪个线程。调度器记录每一次有多个线程可以运行时的选择（Schedule），
+//深度优先地枚举这些选择，或者用随机数种子选择；失败时给出 Schedule，用 Replay 可以一步不差地重放。
+//
+//场景必须是确定性的：除了调度之外，相同的 Schedule 要产生相同的执行（不要依赖 map 的遍历顺序、时间、真正的 goroutine）。
+//没有被包装的操作（普通变量、sync 包的锁）对调度器不可见，它们之间不会发生切换。
+
+//Options 探索的配置
+type Options struct {
+	//Random 为 true 时每一步随机选择，否则深度优先枚举所有调度
+	Random bool
+	//Seed 随机选择使用的种子，为 0 时使用当前时间
+	Seed int64
+	//Runs 最多执行的次数，默认 1000
+	Runs int
+	//MaxSteps 单次执行最多的调度次数，超过就认为发生了活锁，默认 10000
+	MaxSteps int
+}
+
+func (o Options) withDefaults() Options {
+	if o.Runs <= 0 {
+		o.Runs = 1000
+	}
+	if o.MaxSteps <= 0 {
+		o.MaxSteps = 10000
+	}
+	if o.Random && o.Seed == 0 {
+		o.Seed = time.Now().UnixNano()
+	}
+	return o
+}
+
+//Schedule 一次执行中每次有多个线程可以运行时选中的线程编号
+type Schedule []int
+
+func (s Schedule) String() string {
+	parts := make([]string, len(s))
+	for i, id := range s {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+//ParseSchedule 解析 Schedule.String 的结果
+func ParseSchedule(str string) (Schedule, error) {
+	if str == "" {
+		return Schedule{}, nil
+	}
+	parts := strings.Split(str, ",")
+	s := make(Schedule, len(parts))
+	for i, p := range parts {
+		id, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf("explore: bad schedule %q: %v", str, err)
+		}
+		s[i] = id
+	}
+	return s, nil
+}
+
+//Failure 一次失败的执行
+type Failure struct {
+	Schedule Schedule
+	Errors   []string
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("explore: schedule %q failed:\n%s", f.Schedule.String(), strings.Join(f.Errors, "\n"))
+}
+
+//Result 探索的结果
+type Result struct {
+	//Runs 执行的次数
+	Runs int
+	//Exhaustive 深度优先枚举完了所有的调度
+	Exhaustive bool
+	//Failure 第一次失败的执行，没有失败时为 nil
+	Failure *Failure
+}
+
+//Explore 反复执行场景 f，直到发现失败、枚举完所有调度或者达到 Runs 次
+func Explore(opts Options, f func(t *T)) *Result {
+	opts = opts.withDefaults()
+	res := &Result{}
+
+	var rng *rand.Rand
+	if opts.Random {
+		rng = rand.New(rand.NewSource(opts.Seed))
+	}
+	var trail []choice //深度优先时当前执行的选择
+	for res.Runs < opts.Runs {
+		s := newScheduler(opts.MaxSteps)
+		if opts.Random {
+			s.choose = func(runnable []*thread) (int, error) { return rng.Intn(len(runnable)), nil }
+		} else {
+			step := 0
+			s.choose = func(runnable []*thread) (int, error) {
+				defer func() { step++ }()
+				if step < len(trail) {
+					if trail[step].n != len(runnable) {
+						return 0, errNondeterministic
+					}
+					return trail[step].i, nil
+				}
+				trail = append(trail, choice{i: 0, n: len(runnable)})
+				return 0, nil
+			}
+		}
+
+		res.Runs++
+		if fail := s.run(f); fail != nil {
+			res.Failure = fail
+			return res
+		}
+
+		if !opts.Random {
+			//回溯到最后一个还有其他选择的位置
+			for len(trail) > 0 && trail[len(trail)-1].i+1 >= trail[len(trail)-1].n {
+				trail = trail[:len(trail)-1]
+			}
+			if len(trail) == 0 {
+				res.Exhaustive = true
+				return res
+			}
+			trail[len(trail)-1].i++
+		}
+	}
+	return res
+}
+
+//Replay 按照给定的调度执行一次场景，没有失败时返回 nil
+func Replay(schedule Schedule, f func(t *T)) *Failure {
+	s := newScheduler(Options{}.withDefaults().MaxSteps)
+	step := 0
+	s.choose = func(runnable []*thread) (int, error) {
+		if step >= len(schedule) {
+			return 0, fmt.Errorf("explore: schedule has only %d steps", len(schedule))
+		}
+		id := schedule[step]
+		step++
+		for i, th := range runnable {
+			if th.id == id {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("explore: step %d: thread %d is not runnable", step-1, id)
+	}
+	return s.run(f)
+}
+
+//Check 在测试中探索场景，发现失败时输出可以重放的调度
+func Check(tb testing.TB, opts Options, f func(t *T)) *Result {
+	tb.Helper()
+	res := Explore(opts, f)
+	if res.Failure != nil {
+		tb.Fatalf("%v\nafter %d runs; replay with explore.Replay(explore.ParseSchedule(%q))",
+			res.Failure, res.Runs, res.Failure.Schedule.String())
+	}
+	return res
+}
+
+type choice struct {
+	i, n int
+}
+
+var (
+	//errAbort 用来结束被中止的线程
+	errAbort = errors.New("explore: aborted")
+	//errNondeterministic 相同的调度前缀得到了不同的可运行线程
+	errNondeterministic = errors.New("explore: scenario is not deterministic")
+)
+
+type thread struct {
+	id   int
+	wake chan bool //true 继续运行，false 中止
+	done bool
+	vc   vclock
+
+	//阻塞的原因和可以继续的条件，enabled 为 nil 表示随时可以运行
+	waiting string
+	enabled func() bool
+}
+
+func (th *thread) runnable() bool {
+	return !th.done && (th.enabled == nil || th.enabled())
+}
+
+type scheduler struct {
+	threads  []*thread
+	current  *thread
+	back     chan struct{} //当前线程让出或者结束
+	choose   func(runnable []*thread) (int, error)
+	maxSteps int
+
+	schedule Schedule
+	errors   []string
+	failed   bool
+	stop     bool //出现了无法继续的错误，结束这次执行
+	aborting bool
+}
+
+func newScheduler(maxSteps int) *scheduler {
+	return &scheduler{back: make(chan struct{}), maxSteps: maxSteps}
+}
+
+//run 执行一次场景，所有线程结束后返回
+func (s *scheduler) run(f func(t *T)) *Failure {
+	t := &T{s: s}
+	s.spawn(nil, func() { f(t) })
+
+	for steps := 0; !s.stop; steps++ {
+		runnable := s.runnable()
+		if len(runnable) == 0 {
+			if pending := s.pending(); pending != "" {
+				s.fatalf("deadlock: %s", pending)
+			}
+			break
+		}
+		if steps >= s.maxSteps {
+			s.fatalf("livelock: no progress after %d steps: %s", steps, s.pending())
+			break
+		}
+
+		next := runnable[0]
+		if len(runnable) > 1 {
+			i, err := s.choose(runnable)
+			if err != nil {
+				s.fatalf("%v", err)
+				break
+			}
+			next = runnable[i]
+			s.schedule = append(s.schedule, next.id)
+		}
+		s.current = next
+		next.wake <- true
+		<-s.back
+	}
+
+	//中止还没有结束的线程
+	s.aborting = true
+	for _, th := range s.threads {
+		if !th.done {
+			s.current = th
+			th.wake <- false
+			<-s.back
+		}
+	}
+
+	if !s.failed {
+		return nil
+	}
+	return &Failure{Schedule: s.schedule, Errors: s.errors}
+}
+
+//runnable 可以运行的线程，从当前线程的下一个开始轮转，当前线程在最后；
+//深度优先时默认选第一个，所以没有被改变的部分是公平的轮转调度，自旋等待总能等到其他线程
+func (s *scheduler) runnable() []*thread {
+	var runnable []*thread
+	start := 0
+	if s.current != nil {
+		start = s.current.id + 1
+	}
+	for i := range s.threads {
+		if th := s.threads[(start+i)%len(s.threads)]; th.runnable() {
+			runnable = append(runnable, th)
+		}
+	}
+	return runnable
+}
+
+//pending 没有结束的线程和它们停在哪里
+func (s *scheduler) pending() string {
+	var parts []string
+	for _, th := range s.threads {
+		if !th.done {
+			parts = append(parts, fmt.Sprintf("thread %d in %s", th.id, th.waiting))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+//spawn 创建线程，parent 为 nil 表示场景的主线程
+func (s *scheduler) spawn(parent *thread, f func()) {
+	th := &thread{id: len(s.threads), wake: make(chan bool), waiting: "start"}
+	if parent != nil {
+		th.vc = parent.vc.clone()
+		parent.vc.tick(parent.id)
+	}
+	th.vc.tick(th.id)
+	s.threads = append(s.threads, th)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil && r != errAbort {
+				s.fatalf("thread %d panicked: %v\n%s", th.id, r, debug.Stack())
+			}
+			th.done = true
+			s.back <- struct{}{}
+		}()
+		if !<-th.wake {
+			panic(errAbort)
+		}
+		th.waiting = ""
+		f()
+	}()
+}
+
+//point 当前线程在这里让出，直到 enabled 成立并且被调度器选中
+func (s *scheduler) point(what string, enabled func() bool) *thread {
+	th := s.current
+	if s.aborting {
+		panic(errAbort)
+	}
+	th.waiting, th.enabled = what, enabled
+	s.back <- struct{}{}
+	if !<-th.wake {
+		panic(errAbort)
+	}
+	th.waiting, th.enabled = "", nil
+	return th
+}
+
+func (s *scheduler) errorf(format string, args ...interface{}) {
+	s.failed = true
+	s.errors = append(s.errors, fmt.Sprintf(format, args...))
+}
+
+func (s *scheduler) fatalf(format string, args ...interface{}) {
+	s.errorf(format, args...)
+	s.stop = true
+}
+
+//T 传给场景函数，用来创建线程和报告错误
+type T struct {
+	s *scheduler
+}
+
+//Go 创建一个线程执行 f，相当于 go f()
+func (t *T) Go(f func()) {
+	t.s.spawn(t.s.current, f)
+}
+
+//Wait 等待其他所有线程结束，只能在场景函数本身（主线程）中调用
+func (t *T) Wait() {
+	main := t.s.current
+	t.s.point("Wait", func() bool {
+		for _, th := range t.s.threads {
+			if th != main && !th.done {
+				return false
+			}
+		}
+		return true
+	})
+	for _, th := range t.s.threads {
+		main.vc.join(th.vc)
+	}
+}
+
+//Yield 显式的让出点
+func (t *T) Yield() {
+	t.s.point("Yield", nil)
+}
+
+//ID 当前线程的编号，主线程是 0，可以用来代替 goroutine id
+func (t *T) ID() int {
+	return t.s.current.id
+}
+
+//Errorf 记录一个错误，执行会继续，结束后这次执行算作失败
+func (t *T) Errorf(format string, args ...interface{}) {
+	t.s.errorf("thread %d: %s", t.s.current.id, fmt.Sprintf(format, args...))
+}
+
+//Fatalf 记录一个错误并中止这次执行
+func (t *T) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	t.s.stop = true
+	panic(errAbort)
+}
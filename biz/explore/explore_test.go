@@ -0,0 +1,307 @@
+package explore_test
+
+import (
+	"go-learn.com/v1/biz/explore"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//counter 两个线程各自对 Var 加一，locked 为 true 时用 Mutex 保护
+func counter(locked bool) func(t *explore.T) {
+	return func(t *explore.T) {
+		n := explore.NewVar(t, "n", 0)
+		mu := explore.NewMutex(t)
+		incr := func() {
+			if locked {
+				mu.Lock()
+				defer mu.Unlock()
+			}
+			n.Store(n.Load().(int) + 1)
+		}
+		t.Go(incr)
+		t.Go(incr)
+		t.Wait()
+		if got := n.Load().(int); got != 2 {
+			t.Errorf("n = %d, want 2", got)
+		}
+	}
+}
+
+//TestLostUpdate 没有加锁的读-改-写：深度优先能找到丢失更新，并且报告数据竞争
+func TestLostUpdate(t *testing.T) {
+	res := explore.Explore(explore.Options{}, counter(false))
+	if res.Failure == nil {
+		t.Fatalf("no failure after %d runs", res.Runs)
+	}
+	msg := res.Failure.Error()
+	if !strings.Contains(msg, "data race on n") {
+		t.Fatalf("failure does not report the race:\n%s", msg)
+	}
+
+	//按失败的调度重放，得到完全相同的结果
+	again := explore.Replay(res.Failure.Schedule, counter(false))
+	if again == nil || !reflect.DeepEqual(again.Errors, res.Failure.Errors) {
+		t.Fatalf("replay = %v, want %v", again, res.Failure)
+	}
+}
+
+//TestMutexCounter 加锁之后所有调度都是正确的
+func TestMutexCounter(t *testing.T) {
+	res := explore.Check(t, explore.Options{}, counter(true))
+	if !res.Exhaustive || res.Runs < 2 {
+		t.Fatalf("runs = %d, exhaustive = %v", res.Runs, res.Exhaustive)
+	}
+}
+
+//TestRandomReplay 随机探索找到的调度可以通过字符串重放
+func TestRandomReplay(t *testing.T) {
+	res := explore.Explore(explore.Options{Random: true, Seed: 1}, counter(false))
+	if res.Failure == nil {
+		t.Fatalf("no failure after %d runs", res.Runs)
+	}
+	schedule, err := explore.ParseSchedule(res.Failure.Schedule.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(schedule, res.Failure.Schedule) {
+		t.Fatalf("ParseSchedule = %v, want %v", schedule, res.Failure.Schedule)
+	}
+	if again := explore.Replay(schedule, counter(false)); again == nil || !reflect.DeepEqual(again.Errors, res.Failure.Errors) {
+		t.Fatalf("replay = %v, want %v", again, res.Failure)
+	}
+
+	//相同的种子得到相同的结果
+	if same := explore.Explore(explore.Options{Random: true, Seed: 1}, counter(false)); !reflect.DeepEqual(same, res) {
+		t.Fatalf("second run = %+v, want %+v", same, res)
+	}
+}
+
+//TestDeadlock race.Deadlock 中以相反的顺序获取两把锁
+func TestDeadlock(t *testing.T) {
+	res := explore.Explore(explore.Options{}, func(t *explore.T) {
+		ps, property := explore.NewMutex(t), explore.NewMutex(t)
+		t.Go(func() {
+			ps.Lock()
+			property.Lock()
+			property.Unlock()
+			ps.Unlock()
+		})
+		t.Go(func() {
+			property.Lock()
+			ps.Lock()
+			ps.Unlock()
+			property.Unlock()
+		})
+		t.Wait()
+	})
+	if res.Failure == nil || !strings.Contains(res.Failure.Error(), "deadlock: thread 0 in Wait, thread 1 in Mutex.Lock, thread 2 in Mutex.Lock") {
+		t.Fatalf("failure = %v", res.Failure)
+	}
+}
+
+//TestChan 无缓冲的 Chan 传递数据建立了 happens-before，不会报告数据竞争
+func TestChan(t *testing.T) {
+	explore.Check(t, explore.Options{}, func(t *explore.T) {
+		data := explore.NewVar(t, "data", 0)
+		c := explore.NewChan(t, 0)
+		t.Go(func() {
+			data.Store(42)
+			c.Send(struct{}{})
+			c.Close()
+		})
+		t.Go(func() {
+			for {
+				if _, ok := c.Recv(); !ok {
+					return
+				}
+				if got := data.Load().(int); got != 42 {
+					t.Errorf("data = %d", got)
+				}
+			}
+		})
+		t.Wait()
+	})
+}
+
+//下面用包装过的原语照抄 atomic.LKQueue 的实现
+
+type qnode struct {
+	value interface{}
+	next  *explore.Value
+}
+
+type lkQueue struct {
+	head, tail *explore.Value
+}
+
+func newLKQueue(t *explore.T) *lkQueue {
+	n := &qnode{next: explore.NewValue(t, (*qnode)(nil))}
+	return &lkQueue{head: explore.NewValue(t, n), tail: explore.NewValue(t, n)}
+}
+
+func (q *lkQueue) enqueue(t *explore.T, v interface{}) {
+	n := &qnode{value: v, next: explore.NewValue(t, (*qnode)(nil))}
+	for {
+		tail := q.tail.Load().(*qnode)
+		next := tail.next.Load().(*qnode)
+		if tail == q.tail.Load().(*qnode) {
+			if next == nil {
+				if tail.next.CompareAndSwap(next, n) {
+					q.tail.CompareAndSwap(tail, n)
+					return
+				}
+			} else {
+				q.tail.CompareAndSwap(tail, next)
+			}
+		}
+	}
+}
+
+//dequeue headFromTail 为 true 时保留原来的错误：head 是从 q.tail 读出来的
+func (q *lkQueue) dequeue(headFromTail bool) interface{} {
+	for {
+		var head *qnode
+		if headFromTail {
+			head = q.tail.Load().(*qnode)
+		} else {
+			head = q.head.Load().(*qnode)
+		}
+		tail := q.tail.Load().(*qnode)
+		next := head.next.Load().(*qnode)
+		if head == q.head.Load().(*qnode) {
+			if head == tail {
+				if next == nil {
+					return nil
+				}
+				q.tail.CompareAndSwap(tail, next)
+			} else {
+				v := next.value
+				if q.head.CompareAndSwap(head, next) {
+					return v
+				}
+			}
+		}
+	}
+}
+
+//lkQueueScenario 两个生产者并发入队，同时一个消费者出队，最后取出剩下的元素，每个元素恰好出现一次
+func lkQueueScenario(headFromTail bool) func(t *explore.T) {
+	return func(t *explore.T) {
+		q := newLKQueue(t)
+		got := make(map[interface{}]int)
+		t.Go(func() { q.enqueue(t, 1) })
+		t.Go(func() { q.enqueue(t, 2) })
+		t.Go(func() {
+			if v := q.dequeue(headFromTail); v != nil {
+				got[v]++
+			}
+		})
+		t.Wait()
+		for {
+			v := q.dequeue(headFromTail)
+			if v == nil {
+				break
+			}
+			got[v]++
+		}
+		if !reflect.DeepEqual(got, map[interface{}]int{1: 1, 2: 1}) {
+			t.Errorf("dequeued %v", got)
+		}
+	}
+}
+
+//TestLKQueueHeadFromTail 原来的 LKQueue.Dequeue 把 q.tail 当成 head 读取：队列不空时 head 永远不等于 q.head，
+//第一次执行就会以活锁失败，不需要碰运气
+func TestLKQueueHeadFromTail(t *testing.T) {
+	res := explore.Explore(explore.Options{MaxSteps: 1000}, lkQueueScenario(true))
+	if res.Failure == nil || !strings.Contains(res.Failure.Error(), "livelock") {
+		t.Fatalf("failure = %v", res.Failure)
+	}
+	if res.Runs != 1 {
+		t.Fatalf("found after %d runs, want 1", res.Runs)
+	}
+}
+
+//TestLKQueue 从 q.head 读取 head 之后，探索到的调度都是正确的
+func TestLKQueue(t *testing.T) {
+	runs := 2000
+	if testing.Short() {
+		runs = 200
+	}
+	explore.Check(t, explore.Options{Runs: runs}, lkQueueScenario(false))
+	explore.Check(t, explore.Options{Runs: runs, Random: true, Seed: 1}, lkQueueScenario(false))
+}
+
+//tokenMutex 照抄 race.TokenRecursiveMutex 原来的实现，token、recursion 是普通字段
+type tokenMutex struct {
+	mu        *explore.Mutex
+	token     *explore.Value
+	recursion *explore.Var
+}
+
+func (m *tokenMutex) Lock(token int64) {
+	if m.token.Load().(int64) == token {
+		m.recursion.Store(m.recursion.Load().(int) + 1)
+		return
+	}
+	m.mu.Lock()
+	m.token.Store(token)
+	m.recursion.Store(1)
+}
+
+func (m *tokenMutex) Unlock(token int64) {
+	if m.token.Load().(int64) != token {
+		panic("wrong owner")
+	}
+	m.recursion.Store(m.recursion.Load().(int) - 1)
+	if m.recursion.Load().(int) != 0 {
+		return
+	}
+	m.token.Store(int64(0))
+	m.mu.Unlock()
+}
+
+//TestTokenRecursiveMutex 零值的 token 也是 0：两个用 token 0 的 goroutine 都走进"重入"的分支，
+//没有持有锁就修改 recursion，也同时进入了临界区
+func TestTokenRecursiveMutex(t *testing.T) {
+	res := explore.Explore(explore.Options{}, func(t *explore.T) {
+		m := &tokenMutex{mu: explore.NewMutex(t), token: explore.NewValue(t, int64(0)), recursion: explore.NewVar(t, "recursion", 0)}
+		inside := explore.NewInt64(t, 0)
+		worker := func() {
+			m.Lock(0)
+			if n := inside.Add(1); n > 1 {
+				t.Errorf("%d goroutines inside the critical section", n)
+			}
+			inside.Add(-1)
+			m.Unlock(0)
+		}
+		t.Go(worker)
+		t.Go(worker)
+		t.Wait()
+	})
+	if res.Failure == nil {
+		t.Fatalf("no failure after %d runs", res.Runs)
+	}
+	msg := res.Failure.Error()
+	if !strings.Contains(msg, "data race on recursion") || !strings.Contains(msg, "inside the critical section") {
+		t.Fatalf("failure = %v", msg)
+	}
+}
+
+//TestFatalf Fatalf 中止这次执行，阻塞的线程也会被结束
+func TestFatalf(t *testing.T) {
+	res := explore.Explore(explore.Options{}, func(t *explore.T) {
+		mu := explore.NewMutex(t)
+		mu.Lock()
+		t.Go(func() {
+			mu.Lock()
+			t.Errorf("acquired a mutex that is never unlocked")
+		})
+		t.Yield()
+		t.Fatalf("stop")
+	})
+	if res.Failure == nil || len(res.Failure.Errors) != 1 || !strings.Contains(res.Failure.Errors[0], "stop") {
+		t.Fatalf("failure = %v", res.Failure)
+	}
+}
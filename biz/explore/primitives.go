@@ -0,0 +1,271 @@
+package explore
+
+//下面的原语只能在同一个场景中使用，每个操作之前都是一个让出点。
+//同一时刻只有一个线程在运行，所以它们的状态不需要真正的同步。
+
+//Mutex 互斥锁，实现了 sync.Locker
+type Mutex struct {
+	s      *scheduler
+	locked bool
+	vc     vclock //最后一次 Unlock 时的时钟
+}
+
+//NewMutex 创建 Mutex
+func NewMutex(t *T) *Mutex {
+	return &Mutex{s: t.s}
+}
+
+//Lock 获取锁，锁被持有时阻塞
+func (m *Mutex) Lock() {
+	th := m.s.point("Mutex.Lock", func() bool { return !m.locked })
+	m.locked = true
+	th.vc.join(m.vc)
+}
+
+//TryLock 尝试获取锁
+func (m *Mutex) TryLock() bool {
+	th := m.s.point("Mutex.TryLock", nil)
+	if m.locked {
+		return false
+	}
+	m.locked = true
+	th.vc.join(m.vc)
+	return true
+}
+
+//Unlock 释放锁
+func (m *Mutex) Unlock() {
+	th := m.s.point("Mutex.Unlock", nil)
+	if !m.locked {
+		panic("explore: unlock of unlocked mutex")
+	}
+	m.locked = false
+	m.vc = th.vc.clone()
+	th.vc.tick(th.id)
+}
+
+//Chan 通道，容量为 0 时发送方要等到接收方取走之后才返回
+type Chan struct {
+	s        *scheduler
+	capacity int
+	buf      []message
+	closed   bool
+	closeVC  vclock
+	sent     int
+	received int
+	acks     map[int]vclock //无缓冲时接收方的时钟，按发送序号
+}
+
+type message struct {
+	v   interface{}
+	seq int
+	vc  vclock
+}
+
+//NewChan 创建容量为 capacity 的 Chan
+func NewChan(t *T, capacity int) *Chan {
+	return &Chan{s: t.s, capacity: capacity, acks: make(map[int]vclock)}
+}
+
+//Send 发送，相当于 c <- v
+func (c *Chan) Send(v interface{}) {
+	limit := c.capacity
+	if limit == 0 {
+		limit = 1
+	}
+	th := c.s.point("Chan.Send", func() bool { return c.closed || len(c.buf) < limit })
+	if c.closed {
+		panic("explore: send on closed channel")
+	}
+	seq := c.sent
+	c.sent++
+	c.buf = append(c.buf, message{v: v, seq: seq, vc: th.vc.clone()})
+	th.vc.tick(th.id)
+	if c.capacity > 0 {
+		return
+	}
+
+	c.s.point("Chan.Send", func() bool { return c.closed || c.received > seq })
+	if c.received <= seq {
+		panic("explore: send on closed channel")
+	}
+	th.vc.join(c.acks[seq])
+	delete(c.acks, seq)
+}
+
+//Recv 接收，相当于 v, ok := <-c
+func (c *Chan) Recv() (interface{}, bool) {
+	th := c.s.point("Chan.Recv", func() bool { return c.closed || len(c.buf) > 0 })
+	if len(c.buf) == 0 {
+		th.vc.join(c.closeVC)
+		return nil, false
+	}
+	m := c.buf[0]
+	c.buf = c.buf[1:]
+	c.received++
+	th.vc.join(m.vc)
+	if c.capacity == 0 {
+		c.acks[m.seq] = th.vc.clone()
+		th.vc.tick(th.id)
+	}
+	return m.v, true
+}
+
+//Close 关闭，相当于 close(c)
+func (c *Chan) Close() {
+	th := c.s.point("Chan.Close", nil)
+	if c.closed {
+		panic("explore: close of closed channel")
+	}
+	c.closed = true
+	c.closeVC = th.vc.clone()
+	th.vc.tick(th.id)
+	if c.capacity == 0 {
+		//没有被接收的消息，发送方会 panic
+		c.buf = nil
+	}
+}
+
+//Int64 原子整数，对应 atomic.LoadInt64 等操作
+type Int64 struct {
+	s  *scheduler
+	v  int64
+	vc vclock
+}
+
+//NewInt64 创建初始值为 v 的 Int64
+func NewInt64(t *T, v int64) *Int64 {
+	return &Int64{s: t.s, v: v}
+}
+
+//Load 原子读取
+func (a *Int64) Load() int64 {
+	a.sync(a.s.point("Int64.Load", nil))
+	return a.v
+}
+
+//Store 原子写入
+func (a *Int64) Store(v int64) {
+	a.sync(a.s.point("Int64.Store", nil))
+	a.v = v
+}
+
+//Add 原子加，返回新的值
+func (a *Int64) Add(delta int64) int64 {
+	a.sync(a.s.point("Int64.Add", nil))
+	a.v += delta
+	return a.v
+}
+
+//CompareAndSwap 原子比较并交换
+func (a *Int64) CompareAndSwap(old, new int64) bool {
+	a.sync(a.s.point("Int64.CompareAndSwap", nil))
+	if a.v != old {
+		return false
+	}
+	a.v = new
+	return true
+}
+
+//sync 原子操作是顺序一致的，每次操作都相当于获取再释放
+func (a *Int64) sync(th *thread) {
+	th.vc.join(a.vc)
+	a.vc = th.vc.clone()
+	th.vc.tick(th.id)
+}
+
+//Value 原子保存任意值，对应 atomic.LoadPointer、CompareAndSwapPointer 等操作，
+//CompareAndSwap 用 == 比较，所以存放指针时要注意带类型的 nil 和 nil 不相等
+type Value struct {
+	s  *scheduler
+	v  interface{}
+	vc vclock
+}
+
+//NewValue 创建初始值为 v 的 Value
+func NewValue(t *T, v interface{}) *Value {
+	return &Value{s: t.s, v: v}
+}
+
+//Load 原子读取
+func (a *Value) Load() interface{} {
+	a.sync(a.s.point("Value.Load", nil))
+	return a.v
+}
+
+//Store 原子写入
+func (a *Value) Store(v interface{}) {
+	a.sync(a.s.point("Value.Store", nil))
+	a.v = v
+}
+
+//CompareAndSwap 原子比较并交换
+func (a *Value) CompareAndSwap(old, new interface{}) bool {
+	a.sync(a.s.point("Value.CompareAndSwap", nil))
+	if a.v != old {
+		return false
+	}
+	a.v = new
+	return true
+}
+
+func (a *Value) sync(th *thread) {
+	th.vc.join(a.vc)
+	a.vc = th.vc.clone()
+	th.vc.tick(th.id)
+}
+
+//Var 普通的（非原子的）变量，读写之前都会让出，
+//并且按 happens-before 检查数据竞争：两个线程访问同一个 Var、至少一个是写、之间没有同步就报告
+type Var struct {
+	s    *scheduler
+	name string
+	v    interface{}
+
+	lastWrite epoch
+	reads     map[int]uint64 //线程 -> 最后一次读取时的时钟
+}
+
+//epoch 某个线程在某个时钟的一次访问
+type epoch struct {
+	thread int
+	clock  uint64
+}
+
+//NewVar 创建初始值为 v 的 Var，name 出现在数据竞争的报告中
+func NewVar(t *T, name string, v interface{}) *Var {
+	return &Var{s: t.s, name: name, v: v, lastWrite: epoch{thread: -1}, reads: make(map[int]uint64)}
+}
+
+//Load 读取
+func (x *Var) Load() interface{} {
+	th := x.s.point("Var.Load "+x.name, nil)
+	x.checkWrite(th, "read")
+	x.reads[th.id] = th.vc.get(th.id)
+	return x.v
+}
+
+//Store 写入
+func (x *Var) Store(v interface{}) {
+	th := x.s.point("Var.Store "+x.name, nil)
+	x.checkWrite(th, "write")
+	racy := -1
+	for id, clock := range x.reads {
+		if id != th.id && clock > th.vc.get(id) && (racy < 0 || id < racy) {
+			racy = id
+		}
+	}
+	if racy >= 0 {
+		x.s.errorf("data race on %s: write by thread %d, previous read by thread %d", x.name, th.id, racy)
+	}
+	x.lastWrite = epoch{thread: th.id, clock: th.vc.get(th.id)}
+	x.reads = make(map[int]uint64)
+	x.v = v
+}
+
+func (x *Var) checkWrite(th *thread, op string) {
+	w := x.lastWrite
+	if w.thread >= 0 && w.thread != th.id && w.clock > th.vc.get(w.thread) {
+		x.s.errorf("data race on %s: %s by thread %d, previous write by thread %d", x.name, op, th.id, w.thread)
+	}
+}
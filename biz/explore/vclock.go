@@ -0,0 +1,37 @@
+package explore
+
+//vclock 向量时钟，下标是线程编号，用来判断两次访问之间有没有 happens-before 关系
+type vclock []uint64
+
+func (v vclock) get(id int) uint64 {
+	if id < len(v) {
+		return v[id]
+	}
+	return 0
+}
+
+//tick 线程自己的时钟加一，在每次释放（Unlock、发送、原子操作、创建线程）之后调用
+func (v *vclock) tick(id int) {
+	v.grow(id + 1)
+	(*v)[id]++
+}
+
+//join 取两个时钟每一项的最大值，在每次获取（Lock、接收、原子操作、Wait）之后调用
+func (v *vclock) join(o vclock) {
+	v.grow(len(o))
+	for i, c := range o {
+		if c > (*v)[i] {
+			(*v)[i] = c
+		}
+	}
+}
+
+func (v vclock) clone() vclock {
+	return append(vclock(nil), v...)
+}
+
+func (v *vclock) grow(n int) {
+	for len(*v) < n {
+		*v = append(*v, 0)
+	}
+}
@@ -0,0 +1,25 @@
+package goid
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+)
+
+/**
+ @desc 获取当前 goroutine 的 id
+ @date 2026-10-18
+*/
+
+//Get 从 runtime.Stack 的第一行 "goroutine 18 [running]:" 中解析出 goroutine id
+//这是标准库公开的输出格式，不像 petermattis/goid 那样依赖 runtime 内部结构，新版本 Go 也可用，代价是每次调用一到几微秒，调用栈越深越慢
+func Get() int64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	b := bytes.TrimPrefix(buf[:n], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
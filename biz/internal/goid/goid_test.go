@@ -0,0 +1,41 @@
+package goid_test
+
+import (
+	"bytes"
+	"go-learn.com/v1/biz/internal/goid"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func stackID() int64 {
+	var buf [64]byte
+	b := bytes.Fields(buf[:runtime.Stack(buf[:], false)])
+	id, _ := strconv.ParseInt(string(b[1]), 10, 64)
+	return id
+}
+
+//TestGet 每个 goroutine 得到的都是 runtime.Stack 里的 id
+func TestGet(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, want := goid.Get(), stackID(); got != want {
+				t.Errorf("Get() = %d, want %d", got, want)
+			}
+		}()
+	}
+	wg.Wait()
+	if got, want := goid.Get(), stackID(); got != want {
+		t.Errorf("Get() = %d, want %d", got, want)
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		goid.Get()
+	}
+}
@@ -0,0 +1,214 @@
+package lockprof
+
+import (
+	"go-learn.com/v1/biz/internal/goid"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ @desc 锁竞争分析：包装任意 sync.Locker，按调用位置统计等锁时间和持锁时间
+ @date 2026-10-18
+*/
+
+//服务变慢的时候，race、waitGroup、readersWriters 里的 Counter 这类锁往往就是要分析的对象。
+//把锁包装一层后，每次 Lock 记录等待了多久，每次 Unlock 记录从拿到锁到释放持有了多久，
+//两者都记在调用 Lock（RLock）的那一行代码上，最后按总等待时间或者最长持有时间排序输出。
+
+//Profiler 收集一组锁的统计数据
+type Profiler struct {
+	mu    sync.RWMutex
+	sites map[siteKey]*site
+}
+
+//NewProfiler 创建一个 Profiler
+func NewProfiler() *Profiler {
+	return &Profiler{sites: make(map[siteKey]*site)}
+}
+
+//siteKey 锁名 + 调用位置
+type siteKey struct {
+	lock   string
+	pc     uintptr
+	shared bool
+}
+
+//site 一个调用位置的计数，使用原子操作更新，避免分析器本身成为竞争点
+type site struct {
+	acquires  int64
+	waitTotal int64
+	waitMax   int64
+	holdTotal int64
+	holdMax   int64
+}
+
+func (p *Profiler) site(k siteKey) *site {
+	p.mu.RLock()
+	s, ok := p.sites[k]
+	p.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s, ok = p.sites[k]; !ok {
+		s = &site{}
+		p.sites[k] = s
+	}
+	return s
+}
+
+func (s *site) wait(d time.Duration) {
+	atomic.AddInt64(&s.acquires, 1)
+	atomic.AddInt64(&s.waitTotal, int64(d))
+	storeMax(&s.waitMax, int64(d))
+}
+
+func (s *site) hold(d time.Duration) {
+	atomic.AddInt64(&s.holdTotal, int64(d))
+	storeMax(&s.holdMax, int64(d))
+}
+
+func storeMax(addr *int64, v int64) {
+	for {
+		old := atomic.LoadInt64(addr)
+		if v <= old || atomic.CompareAndSwapInt64(addr, old, v) {
+			return
+		}
+	}
+}
+
+//Reset 清空所有统计数据
+func (p *Profiler) Reset() {
+	p.mu.Lock()
+	p.sites = make(map[siteKey]*site)
+	p.mu.Unlock()
+}
+
+//callerPC 获取调用 Lock 的位置
+func callerPC(skip int) uintptr {
+	var pcs [1]uintptr
+	if runtime.Callers(skip+2, pcs[:]) == 0 {
+		return 0
+	}
+	return pcs[0]
+}
+
+//Locker 带统计的 sync.Locker
+type Locker struct {
+	l    sync.Locker
+	name string
+	p    *Profiler
+
+	//下面三个字段只有持有锁的时候才会读写，由被包装的锁保护
+	//可重入锁（race.RecursiveMutex）嵌套加锁时只有最外层的 Lock 记录拿到锁的时间和位置，
+	//最外层的 Unlock 才统计持有时间，否则内层会覆盖外层的记录，外层的持有时间变成 0
+	depth    int
+	acquired time.Time
+	site     *site
+}
+
+//Wrap 包装一个 sync.Locker，比如 *race.Mutex、*race.RecursiveMutex、*sync.RWMutex（写锁）
+func (p *Profiler) Wrap(l sync.Locker, name string) *Locker {
+	return &Locker{l: l, name: name, p: p}
+}
+
+//Lock 获取锁并记录等待时间
+func (l *Locker) Lock() {
+	l.lock(callerPC(1))
+}
+
+func (l *Locker) lock(pc uintptr) {
+	s := l.p.site(siteKey{lock: l.name, pc: pc})
+	start := time.Now()
+	l.l.Lock()
+	now := time.Now()
+	s.wait(now.Sub(start))
+
+	if l.depth++; l.depth == 1 {
+		l.acquired, l.site = now, s
+	}
+}
+
+//Unlock 释放锁，最外层的 Unlock 记录持有时间
+func (l *Locker) Unlock() {
+	var s *site
+	var held time.Duration
+	if l.depth--; l.depth == 0 {
+		s, held = l.site, time.Since(l.acquired)
+		l.site = nil
+	}
+	l.l.Unlock()
+
+	if s != nil {
+		s.hold(held)
+	}
+}
+
+//RWLocker 带统计的读写锁
+type RWLocker struct {
+	Locker
+	rw *sync.RWMutex
+
+	//读锁可以被多个 goroutine 同时持有，按 goroutine 记录拿到读锁的时间
+	mu      sync.Mutex
+	readers map[int64][]reader
+}
+
+type reader struct {
+	acquired time.Time
+	site     *site
+}
+
+//WrapRW 包装一个 sync.RWMutex，读锁和写锁分别统计
+func (p *Profiler) WrapRW(rw *sync.RWMutex, name string) *RWLocker {
+	return &RWLocker{
+		Locker:  Locker{l: rw, name: name, p: p},
+		rw:      rw,
+		readers: make(map[int64][]reader),
+	}
+}
+
+//Lock 获取写锁并记录等待时间
+func (l *RWLocker) Lock() {
+	l.lock(callerPC(1))
+}
+
+//RLock 获取读锁并记录等待时间
+func (l *RWLocker) RLock() {
+	s := l.p.site(siteKey{lock: l.name, pc: callerPC(1), shared: true})
+	start := time.Now()
+	l.rw.RLock()
+	now := time.Now()
+	s.wait(now.Sub(start))
+
+	gid := goid.Get()
+	l.mu.Lock()
+	l.readers[gid] = append(l.readers[gid], reader{acquired: now, site: s})
+	l.mu.Unlock()
+}
+
+//RUnlock 记录读锁的持有时间并释放
+//如果读锁是由另一个 goroutine 释放的，找不到对应的记录，这次持有时间就不统计了
+func (l *RWLocker) RUnlock() {
+	gid := goid.Get()
+	var r reader
+	l.mu.Lock()
+	if rs := l.readers[gid]; len(rs) > 0 {
+		r = rs[len(rs)-1]
+		if len(rs) == 1 {
+			delete(l.readers, gid)
+		} else {
+			l.readers[gid] = rs[:len(rs)-1]
+		}
+	}
+	l.mu.Unlock()
+	l.rw.RUnlock()
+
+	if r.site != nil {
+		r.site.hold(time.Since(r.acquired))
+	}
+}
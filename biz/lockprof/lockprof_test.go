@@ -0,0 +1,129 @@
+package lockprof_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-learn.com/v1/biz/lockprof"
+	"go-learn.com/v1/biz/race"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//TestProfiler 持锁最久的调用位置排在最前面
+func TestProfiler(t *testing.T) {
+	p := lockprof.NewProfiler()
+	mu := p.Wrap(&race.Mutex{}, "mutex")
+	rmu := p.Wrap(&race.RecursiveMutex{}, "recursive")
+	rw := p.WrapRW(&sync.RWMutex{}, "rw")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Unlock()
+
+			rmu.Lock()
+			rmu.Unlock()
+
+			rw.RLock()
+			rw.RUnlock()
+		}()
+	}
+	wg.Wait()
+	rw.Lock()
+	rw.Unlock()
+
+	stats := p.Report(lockprof.ByHoldMax)
+	if len(stats) != 4 {
+		t.Fatalf("got %d sites, want 4: %+v", len(stats), stats)
+	}
+	top := stats[0]
+	if top.Lock != "mutex" || top.Acquires != 4 || top.HoldMax < 5*time.Millisecond {
+		t.Fatalf("top holder = %+v", top)
+	}
+	if !strings.HasSuffix(top.Func, "TestProfiler.func1") || !strings.HasSuffix(top.File, "lockprof_test.go") {
+		t.Fatalf("top site = %s (%s:%d)", top.Func, top.File, top.Line)
+	}
+	//4个goroutine串行持有5ms，至少有一个等待了15ms
+	if w := p.Report(lockprof.ByWaitTotal)[0]; w.Lock != "mutex" || w.WaitMax < 15*time.Millisecond {
+		t.Fatalf("hottest lock = %+v", w)
+	}
+
+	var reads int
+	for _, s := range stats {
+		if s.Lock == "rw" && s.Shared {
+			reads++
+			if s.Acquires != 4 || s.HoldTotal <= 0 {
+				t.Fatalf("read site = %+v", s)
+			}
+		}
+	}
+	if reads != 1 {
+		t.Fatalf("got %d read sites, want 1", reads)
+	}
+}
+
+//TestProfilerNested 可重入锁嵌套加锁时，外层的持有时间从最外层的 Lock 算到最外层的 Unlock
+func TestProfilerNested(t *testing.T) {
+	p := lockprof.NewProfiler()
+	mu := p.Wrap(&race.RecursiveMutex{}, "recursive")
+
+	outer := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	outer()
+
+	stats := p.Report(lockprof.ByHoldMax)
+	if len(stats) != 2 {
+		t.Fatalf("got %d sites, want 2: %+v", len(stats), stats)
+	}
+	if top := stats[0]; top.Acquires != 1 || top.HoldMax < 10*time.Millisecond {
+		t.Fatalf("outer site = %+v, want a hold of at least 10ms", top)
+	}
+	if inner := stats[1]; inner.Acquires != 1 || inner.HoldTotal != 0 {
+		t.Fatalf("inner site = %+v, want no hold of its own", inner)
+	}
+}
+
+//TestProfilerOutput 文本和 JSON 报告
+func TestProfilerOutput(t *testing.T) {
+	p := lockprof.NewProfiler()
+	mu := p.Wrap(&sync.Mutex{}, "counter")
+	mu.Lock()
+	mu.Unlock()
+
+	var text bytes.Buffer
+	if err := p.WriteText(&text, lockprof.ByWaitTotal); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "counter") || !strings.Contains(text.String(), "TestProfilerOutput") {
+		t.Fatalf("text report:\n%s", text.String())
+	}
+
+	var js bytes.Buffer
+	if err := p.WriteJSON(&js, lockprof.ByWaitTotal); err != nil {
+		t.Fatal(err)
+	}
+	var stats []lockprof.SiteStats
+	if err := json.Unmarshal(js.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Lock != "counter" || stats[0].Acquires != 1 {
+		t.Fatalf("json report = %+v", stats)
+	}
+
+	p.Reset()
+	if stats := p.Report(lockprof.ByWaitTotal); len(stats) != 0 {
+		t.Fatalf("Report after Reset = %+v", stats)
+	}
+}
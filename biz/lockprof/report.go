@@ -0,0 +1,111 @@
+package lockprof
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+//SiteStats 一个调用位置的统计结果
+type SiteStats struct {
+	Lock string `json:"lock"`
+	//调用 Lock/RLock 的函数和行号
+	Func   string `json:"func"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Shared bool   `json:"shared"`
+
+	Acquires  int64         `json:"acquires"`
+	WaitTotal time.Duration `json:"wait_total_ns"`
+	WaitMax   time.Duration `json:"wait_max_ns"`
+	HoldTotal time.Duration `json:"hold_total_ns"`
+	HoldMax   time.Duration `json:"hold_max_ns"`
+}
+
+//SortBy 报告的排序方式
+type SortBy int
+
+const (
+	//ByWaitTotal 总等待时间最长的排在前面，也就是竞争最激烈的锁
+	ByWaitTotal SortBy = iota
+	//ByWaitMax 单次等待时间最长
+	ByWaitMax
+	//ByHoldTotal 总持有时间最长
+	ByHoldTotal
+	//ByHoldMax 单次持有时间最长，也就是持有最久的调用
+	ByHoldMax
+)
+
+func (b SortBy) key(s *SiteStats) time.Duration {
+	switch b {
+	case ByWaitMax:
+		return s.WaitMax
+	case ByHoldTotal:
+		return s.HoldTotal
+	case ByHoldMax:
+		return s.HoldMax
+	}
+	return s.WaitTotal
+}
+
+//Report 获取当前的统计结果，按 by 从大到小排序
+func (p *Profiler) Report(by SortBy) []SiteStats {
+	p.mu.RLock()
+	stats := make([]SiteStats, 0, len(p.sites))
+	for k, s := range p.sites {
+		st := SiteStats{
+			Lock:      k.lock,
+			Shared:    k.shared,
+			Acquires:  atomic.LoadInt64(&s.acquires),
+			WaitTotal: time.Duration(atomic.LoadInt64(&s.waitTotal)),
+			WaitMax:   time.Duration(atomic.LoadInt64(&s.waitMax)),
+			HoldTotal: time.Duration(atomic.LoadInt64(&s.holdTotal)),
+			HoldMax:   time.Duration(atomic.LoadInt64(&s.holdMax)),
+		}
+		if fn := runtime.FuncForPC(k.pc); fn != nil {
+			st.Func = fn.Name()
+			st.File, st.Line = fn.FileLine(k.pc - 1)
+		}
+		stats = append(stats, st)
+	}
+	p.mu.RUnlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		ki, kj := by.key(&stats[i]), by.key(&stats[j])
+		if ki != kj {
+			return ki > kj
+		}
+		if stats[i].Lock != stats[j].Lock {
+			return stats[i].Lock < stats[j].Lock
+		}
+		return stats[i].Line < stats[j].Line
+	})
+	return stats
+}
+
+//WriteText 输出文本格式的报告
+func (p *Profiler) WriteText(w io.Writer, by SortBy) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LOCK\tMODE\tACQUIRES\tWAIT TOTAL\tWAIT MAX\tHOLD TOTAL\tHOLD MAX\tSITE")
+	for _, s := range p.Report(by) {
+		mode := "write"
+		if s.Shared {
+			mode = "read"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%v\t%v\t%v\t%v\t%s (%s:%d)\n",
+			s.Lock, mode, s.Acquires, s.WaitTotal, s.WaitMax, s.HoldTotal, s.HoldMax, s.Func, s.File, s.Line)
+	}
+	return tw.Flush()
+}
+
+//WriteJSON 输出 JSON 格式的报告
+func (p *Profiler) WriteJSON(w io.Writer, by SortBy) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p.Report(by))
+}
@@ -0,0 +1,320 @@
+package _map
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+)
+
+/**
+ @desc 有容量上限的分片缓存，LRU 或 LFU 淘汰，支持按字节计算的容量、命中率统计和淘汰回调
+ @date 2026-10-18
+*/
+
+//RWMap、ConcurrentMap 只会变大。Cache 给每个分片分一份容量，写入使分片超出容量时在这个分片内淘汰：
+// LRU 淘汰最久没有被访问的元素，用一个双向链表，访问时移到表头
+// LFU 淘汰访问次数最少的元素，次数相同时淘汰最久没有被访问的，用一个小根堆
+//Get 也会修改访问顺序，所以每个分片用的是 Mutex 而不是 RWMutex。
+//淘汰只看分片自己：总量不超过 Capacity，但某个分片满了淘汰时，别的分片可能还有空间。
+//单个元素的权重不能超过分片的容量，所以 NewCache 按 MaxWeight 减少分片个数，保证最大的元素也放得下。
+
+//EvictionPolicy 淘汰策略
+type EvictionPolicy int
+
+const (
+	//LRU 淘汰最近最少使用的元素
+	LRU EvictionPolicy = iota
+	//LFU 淘汰使用次数最少的元素
+	LFU
+)
+
+//String 策略的名字
+func (p EvictionPolicy) String() string {
+	switch p {
+	case LRU:
+		return "LRU"
+	case LFU:
+		return "LFU"
+	}
+	return "EvictionPolicy(?)"
+}
+
+//CacheOptions Cache 的配置
+type CacheOptions struct {
+	Policy EvictionPolicy
+	//Capacity 所有元素的权重之和的上限，平均分给每个分片
+	Capacity int64
+	//Weigher 计算元素的权重，比如 value 的字节数；为 nil 时每个元素的权重都是 1，Capacity 就是元素个数。
+	//权重必须在 1 到 MaxWeight 之间，否则 Set 不写入、返回 false：0 永远不会触发淘汰，负数会让分片无限增长
+	Weigher func(key string, value interface{}) int64
+	//MaxWeight 单个元素的最大权重，分片的容量不会小于它，超过 Capacity 时 NewCache 会 panic。
+	//默认是 1；设置了 Weigher 时默认是不减少分片个数时每个分片的容量
+	MaxWeight int64
+	//OnEvict 元素因为容量不够被淘汰之后调用（Delete 和覆盖不算），不持有任何锁
+	OnEvict func(key string, value interface{})
+}
+
+//CacheStats 缓存的统计
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Len       int
+	Weight    int64
+}
+
+//HitRate 命中率，没有访问过时是 0
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+//Cache 有容量上限的分片缓存，需要通过 NewCache 创建
+type Cache struct {
+	shards []*cacheShard
+	hasher Hasher
+	opts   CacheOptions
+}
+
+type cacheEntry struct {
+	key    string
+	value  interface{}
+	weight int64
+
+	elem  *list.Element //LRU 链表中的位置
+	index int           //LFU 堆中的下标
+	freq  uint64        //LFU 访问次数
+	tick  uint64        //LFU 最近一次访问的时刻
+}
+
+type cacheShard struct {
+	sync.Mutex
+	items    map[string]*cacheEntry
+	capacity int64
+	weight   int64
+
+	lru  *list.List //表头是最近访问的
+	lfu  lfuHeap
+	tick uint64
+
+	//统计也按分片记录，在分片的锁内修改，所有分片共用一组计数器的话，那个缓存行会成为新的竞争点
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+//NewCache 创建 Cache，分片的选项和 New 相同。每个分片的容量小于 MaxWeight 时会减少分片个数
+func NewCache(o CacheOptions, opts ...Option) *Cache {
+	if o.Capacity <= 0 {
+		panic("map: cache capacity must be positive")
+	}
+	so := newOptions(opts)
+	n := int64(so.shardCount)
+	if o.MaxWeight <= 0 {
+		o.MaxWeight = 1
+		if o.Weigher != nil && o.Capacity/n > 1 {
+			o.MaxWeight = o.Capacity / n
+		}
+	}
+	if o.MaxWeight > o.Capacity {
+		panic("map: cache MaxWeight exceeds Capacity")
+	}
+	if o.Weigher == nil {
+		o.Weigher = func(string, interface{}) int64 { return 1 }
+	}
+	if n > o.Capacity/o.MaxWeight {
+		n = o.Capacity / o.MaxWeight
+	}
+	c := &Cache{shards: make([]*cacheShard, n), hasher: so.hasher, opts: o}
+	for i := range c.shards {
+		//余数分给前面的分片，所有分片的容量之和正好是 Capacity
+		capacity := o.Capacity / n
+		if int64(i) < o.Capacity%n {
+			capacity++
+		}
+		c.shards[i] = &cacheShard{items: make(map[string]*cacheEntry), capacity: capacity, lru: list.New()}
+	}
+	return c
+}
+
+func (c *Cache) shard(key string) *cacheShard {
+	return c.shards[shardIndex(c.hasher.Hash(key), len(c.shards))]
+}
+
+//Get 读取 key 对应的值，并记录一次访问
+func (c *Cache) Get(key string) (interface{}, bool) {
+	s := c.shard(key)
+	s.Lock()
+	e, ok := s.items[key]
+	if ok {
+		c.touch(s, e)
+		s.hits++
+	} else {
+		s.misses++
+	}
+	s.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return e.value, true
+}
+
+//Set 写入键值对，需要时淘汰其他元素。权重不在 1 到 MaxWeight 之间时不写入，返回 false，key 原来的值保持不变
+func (c *Cache) Set(key string, value interface{}) bool {
+	weight := c.opts.Weigher(key, value)
+	if weight <= 0 || weight > c.opts.MaxWeight {
+		return false
+	}
+	s := c.shard(key)
+	var evicted []*cacheEntry
+
+	s.Lock()
+	var freq uint64
+	if old, ok := s.items[key]; ok {
+		//覆盖算一次访问，LFU 的访问次数接着原来的算，否则经常更新的热点 key 反而最先被淘汰
+		freq = old.freq
+		c.remove(s, old)
+	}
+	for s.weight+weight > s.capacity {
+		victim := c.victim(s)
+		c.remove(s, victim)
+		evicted = append(evicted, victim)
+	}
+	e := &cacheEntry{key: key, value: value, weight: weight, freq: freq}
+	s.items[key] = e
+	s.weight += weight
+	c.add(s, e)
+	s.evictions += uint64(len(evicted))
+	s.Unlock()
+
+	if c.opts.OnEvict != nil {
+		for _, e := range evicted {
+			c.opts.OnEvict(e.key, e.value)
+		}
+	}
+	return true
+}
+
+//Delete 删除 key，返回 key 是否存在
+func (c *Cache) Delete(key string) bool {
+	s := c.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	e, ok := s.items[key]
+	if ok {
+		c.remove(s, e)
+	}
+	return ok
+}
+
+//Len 元素个数
+func (c *Cache) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.Lock()
+		n += len(s.items)
+		s.Unlock()
+	}
+	return n
+}
+
+//Weight 所有元素的权重之和
+func (c *Cache) Weight() int64 {
+	var w int64
+	for _, s := range c.shards {
+		s.Lock()
+		w += s.weight
+		s.Unlock()
+	}
+	return w
+}
+
+//Stats 统计信息，逐个分片累加，并发访问时不是同一时刻的
+func (c *Cache) Stats() CacheStats {
+	var st CacheStats
+	for _, s := range c.shards {
+		s.Lock()
+		st.Hits += s.hits
+		st.Misses += s.misses
+		st.Evictions += s.evictions
+		st.Len += len(s.items)
+		st.Weight += s.weight
+		s.Unlock()
+	}
+	return st
+}
+
+//下面的方法都需要持有分片的锁
+
+func (c *Cache) add(s *cacheShard, e *cacheEntry) {
+	if c.opts.Policy == LFU {
+		s.tick++
+		e.freq++
+		e.tick = s.tick
+		heap.Push(&s.lfu, e)
+		return
+	}
+	e.elem = s.lru.PushFront(e)
+}
+
+func (c *Cache) touch(s *cacheShard, e *cacheEntry) {
+	if c.opts.Policy == LFU {
+		s.tick++
+		e.freq++
+		e.tick = s.tick
+		heap.Fix(&s.lfu, e.index)
+		return
+	}
+	s.lru.MoveToFront(e.elem)
+}
+
+func (c *Cache) victim(s *cacheShard) *cacheEntry {
+	if c.opts.Policy == LFU {
+		return s.lfu[0]
+	}
+	return s.lru.Back().Value.(*cacheEntry)
+}
+
+func (c *Cache) remove(s *cacheShard, e *cacheEntry) {
+	if c.opts.Policy == LFU {
+		heap.Remove(&s.lfu, e.index)
+	} else {
+		s.lru.Remove(e.elem)
+	}
+	delete(s.items, e.key)
+	s.weight -= e.weight
+}
+
+//lfuHeap 按访问次数、最近访问时刻排序的小根堆，堆顶是要淘汰的元素
+type lfuHeap []*cacheEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*cacheEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
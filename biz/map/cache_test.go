@@ -0,0 +1,189 @@
+package _map_test
+
+import (
+	_map "go-learn.com/v1/biz/map"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+//TestCacheLRU 淘汰最久没有访问的元素，Get 会刷新访问顺序，覆盖不算淘汰
+func TestCacheLRU(t *testing.T) {
+	var evicted []string
+	c := _map.NewCache(_map.CacheOptions{
+		Policy:   _map.LRU,
+		Capacity: 3,
+		OnEvict:  func(key string, value interface{}) { evicted = append(evicted, key) },
+	}, _map.WithShardCount(1))
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+	c.Set("b", 20) //覆盖，b 变成最近访问的
+	c.Set("d", 4)  //淘汰 c
+	c.Set("e", 5)  //淘汰 a
+	if !reflect.DeepEqual(evicted, []string{"c", "a"}) {
+		t.Fatalf("evicted %v, want [c a]", evicted)
+	}
+	if v, ok := c.Get("b"); !ok || v != 20 || c.Len() != 3 {
+		t.Fatalf("Get(b) = %v, %v, Len = %d", v, ok, c.Len())
+	}
+	if !c.Delete("b") || c.Delete("b") || c.Len() != 2 {
+		t.Fatal("Delete")
+	}
+}
+
+//TestCacheLFU 淘汰访问次数最少的元素，次数相同时淘汰最久没有访问的
+func TestCacheLFU(t *testing.T) {
+	var evicted []string
+	c := _map.NewCache(_map.CacheOptions{
+		Policy:   _map.LFU,
+		Capacity: 3,
+		OnEvict:  func(key string, value interface{}) { evicted = append(evicted, key) },
+	}, _map.WithShardCount(1))
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	for i := 0; i < 3; i++ {
+		c.Get("a")
+	}
+	c.Get("b")
+	c.Get("c")
+	c.Set("d", 4) //b、c 都访问了 2 次，b 更久没有访问
+	c.Set("e", 5) //d 只访问了 1 次
+	if !reflect.DeepEqual(evicted, []string{"b", "d"}) {
+		t.Fatalf("evicted %v, want [b d]", evicted)
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("the most frequently used key was evicted")
+	}
+
+	//经常更新的 key 保留访问次数，不会因为覆盖变成最先淘汰的
+	evicted = nil
+	for i := 0; i < 5; i++ {
+		c.Set("e", i)
+	}
+	c.Set("f", 6) //c 访问了 2 次，e 访问了 6 次
+	if !reflect.DeepEqual(evicted, []string{"c"}) {
+		t.Fatalf("evicted %v, want [c]", evicted)
+	}
+}
+
+//TestCacheWeight 按字节计算容量：一次写入可能淘汰多个元素，比分片容量还大的元素放不下
+func TestCacheWeight(t *testing.T) {
+	c := _map.NewCache(_map.CacheOptions{
+		Capacity: 100,
+		Weigher: func(key string, value interface{}) int64 {
+			if key == "negative" {
+				return -100
+			}
+			return int64(len(value.(string)))
+		},
+	}, _map.WithShardCount(1))
+
+	for i := 0; i < 4; i++ {
+		c.Set(strconv.Itoa(i), string(make([]byte, 25)))
+	}
+	if c.Weight() != 100 || c.Len() != 4 {
+		t.Fatalf("Weight = %d, Len = %d", c.Weight(), c.Len())
+	}
+	c.Set("big", string(make([]byte, 60)))
+	if c.Weight() != 85 || c.Len() != 2 || c.Stats().Evictions != 3 {
+		t.Fatalf("after big: Weight = %d, Len = %d, %+v", c.Weight(), c.Len(), c.Stats())
+	}
+	if c.Set("big", string(make([]byte, 101))) || c.Len() != 2 {
+		t.Fatal("value heavier than the capacity was stored")
+	}
+	if v, ok := c.Get("big"); !ok || len(v.(string)) != 60 {
+		t.Fatal("rejected Set dropped the old value")
+	}
+
+	//权重为 0 或者负数的元素不写入，不影响分片的权重
+	if c.Set("empty", "") || c.Set("negative", "x") || c.Weight() != 85 {
+		t.Fatalf("non-positive weight was stored: Weight = %d", c.Weight())
+	}
+}
+
+//TestCacheMaxWeight 分片按 MaxWeight 减少，默认的分片个数下大元素也放得下；MaxWeight 超过 Capacity 时 panic
+func TestCacheMaxWeight(t *testing.T) {
+	c := _map.NewCache(_map.CacheOptions{
+		Capacity:  100,
+		MaxWeight: 60,
+		Weigher:   func(key string, value interface{}) int64 { return int64(len(value.(string))) },
+	})
+	for i := 0; i < 10; i++ {
+		if !c.Set(strconv.Itoa(i), string(make([]byte, 60))) {
+			t.Fatalf("Set(%d) rejected a value of MaxWeight", i)
+		}
+	}
+	if c.Weight() > 100 {
+		t.Fatalf("Weight = %d over the capacity", c.Weight())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("NewCache accepted MaxWeight > Capacity")
+		}
+	}()
+	_map.NewCache(_map.CacheOptions{Capacity: 10, MaxWeight: 11})
+}
+
+//TestCacheStats 命中、未命中、淘汰的计数
+func TestCacheStats(t *testing.T) {
+	c := _map.NewCache(_map.CacheOptions{Capacity: 2}, _map.WithShardCount(1))
+	c.Set("a", 1)
+	c.Get("a")
+	c.Get("a")
+	c.Get("x")
+	c.Set("b", 2)
+	c.Set("c", 3)
+	s := c.Stats()
+	if s.Hits != 2 || s.Misses != 1 || s.Evictions != 1 || s.Len != 2 || s.Weight != 2 || s.HitRate() != 2.0/3 {
+		t.Fatalf("Stats = %+v", s)
+	}
+}
+
+//TestCacheConcurrent 并发读写时总权重不超过容量，淘汰回调的次数和计数一致
+func TestCacheConcurrent(t *testing.T) {
+	for _, policy := range []_map.EvictionPolicy{_map.LRU, _map.LFU} {
+		t.Run(policy.String(), func(t *testing.T) {
+			var mu sync.Mutex
+			evicted := 0
+			c := _map.NewCache(_map.CacheOptions{
+				Policy:   policy,
+				Capacity: 100,
+				OnEvict: func(key string, value interface{}) {
+					mu.Lock()
+					evicted++
+					mu.Unlock()
+				},
+			}, _map.WithShardCount(8))
+
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 2000; i++ {
+						key := strconv.Itoa((g*7919 + i) % 500)
+						if _, ok := c.Get(key); !ok {
+							c.Set(key, i)
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+
+			s := c.Stats()
+			if s.Weight > 100 || int64(s.Len) != s.Weight {
+				t.Fatalf("Stats = %+v", s)
+			}
+			if s.Hits+s.Misses != 16000 || uint64(evicted) != s.Evictions {
+				t.Fatalf("Stats = %+v, OnEvict called %d times", s, evicted)
+			}
+		})
+	}
+}
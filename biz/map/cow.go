@@ -0,0 +1,115 @@
+package _map
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+/**
+ @desc 写时复制的 map：读只有一次原子读，不加锁；写复制一份新的 map 再原子替换
+ @date 2026-10-18
+*/
+
+//RWMap 的读要 RLock，读者很多时 RWMutex 的 readerCount 这个计数器本身就成了热点（所有 CPU 抢同一个缓存行）。
+//查找表这种一天只改几次、每个请求都要读的数据，更适合写时复制：
+//读者拿到的是某一时刻的 map，之后不会再被修改，所以读的时候不需要任何锁；
+//写者之间用 Mutex 串行，复制当前的 map、修改副本、再用 atomic.Value 发布。
+//每次写都要复制整个 map，写的代价是 O(n)，多个修改请用 Update 一起做，只复制一次。
+
+//COWMap 写时复制的 map，零值可以直接使用
+type COWMap struct {
+	mu sync.Mutex   //写者之间互斥
+	v  atomic.Value //map[string]interface{}，发布之后不再修改
+}
+
+//NewCOWMap 用 m 的副本创建 COWMap，m 可以为 nil
+func NewCOWMap(m map[string]interface{}) *COWMap {
+	c := &COWMap{}
+	c.v.Store(clone(m, 0))
+	return c
+}
+
+func clone(m map[string]interface{}, extra int) map[string]interface{} {
+	c := make(map[string]interface{}, len(m)+extra)
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func (c *COWMap) load() map[string]interface{} {
+	m, _ := c.v.Load().(map[string]interface{})
+	return m //零值的 COWMap 返回 nil，读 nil map 是安全的
+}
+
+//Get 读取 key 对应的值
+func (c *COWMap) Get(key string) (interface{}, bool) {
+	v, ok := c.load()[key]
+	return v, ok
+}
+
+//Has key 是否存在
+func (c *COWMap) Has(key string) bool {
+	_, ok := c.load()[key]
+	return ok
+}
+
+//Len 元素个数
+func (c *COWMap) Len() int {
+	return len(c.load())
+}
+
+//Snapshot 当前的 map，之后的写入不会影响它。返回的 map 是共享的，不能修改
+func (c *COWMap) Snapshot() map[string]interface{} {
+	return c.load()
+}
+
+//Range 遍历调用时的快照，f 返回 false 时停止。f 中可以修改 COWMap，但遍历看不到这些修改
+func (c *COWMap) Range(f func(key string, value interface{}) bool) {
+	for k, v := range c.load() {
+		if !f(k, v) {
+			return
+		}
+	}
+}
+
+//Set 设置一个键值对，复制整个 map
+func (c *COWMap) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := clone(c.load(), 1)
+	m[key] = value
+	c.v.Store(m)
+}
+
+//Delete 删除 key，key 不存在时不复制
+func (c *COWMap) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := c.load()
+	if _, ok := old[key]; !ok {
+		return
+	}
+	m := clone(old, 0)
+	delete(m, key)
+	c.v.Store(m)
+}
+
+//Update 批量修改：f 修改的是当前 map 的副本，f 返回之后一次性发布，读者要么看到全部修改，要么一个都看不到。
+//f 返回 false 时放弃修改。f 执行期间持有写锁，不能在 f 中调用 COWMap 的写方法
+func (c *COWMap) Update(f func(m map[string]interface{}) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := clone(c.load(), 0)
+	if f(m) {
+		c.v.Store(m)
+	}
+}
+
+//Replace 用 m 的副本整体替换当前的 map，适合重新加载整张查找表
+func (c *COWMap) Replace(m map[string]interface{}) {
+	m = clone(m, 0)
+	c.mu.Lock()
+	c.v.Store(m)
+	c.mu.Unlock()
+}
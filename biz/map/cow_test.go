@@ -0,0 +1,133 @@
+package _map_test
+
+import (
+	_map "go-learn.com/v1/biz/map"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+//TestCOWMap 零值可用，Delete 不存在的 key 没有影响，Replace 复制传入的 map
+func TestCOWMap(t *testing.T) {
+	var m _map.COWMap
+	if _, ok := m.Get("a"); ok || m.Len() != 0 || m.Has("a") {
+		t.Fatal("zero value COWMap is not empty")
+	}
+	m.Set("a", 1)
+	m.Set("b", 2)
+	m.Delete("b")
+	m.Delete("c")
+	if v, ok := m.Get("a"); !ok || v != 1 || m.Len() != 1 || m.Has("b") {
+		t.Fatalf("after Set/Delete: %v", m.Snapshot())
+	}
+
+	table := map[string]interface{}{"x": 1, "y": 2}
+	m.Replace(table)
+	table["z"] = 3
+	if m.Len() != 2 || m.Has("a") || m.Has("z") {
+		t.Fatalf("after Replace: %v", m.Snapshot())
+	}
+
+	m.Update(func(m map[string]interface{}) bool {
+		m["x"] = 10
+		return false
+	})
+	if v, _ := m.Get("x"); v != 1 {
+		t.Fatalf("aborted Update was published: x = %v", v)
+	}
+}
+
+//TestCOWMapSnapshot 快照和 Range 看到的是调用时的 map，之后的写入（包括 Range 回调里的写入）不影响它们
+func TestCOWMapSnapshot(t *testing.T) {
+	m := _map.NewCOWMap(map[string]interface{}{"a": 1, "b": 2})
+	snap := m.Snapshot()
+	n := 0
+	m.Range(func(key string, value interface{}) bool {
+		m.Set(key+key, value)
+		m.Delete(key)
+		n++
+		return true
+	})
+	if n != 2 || len(snap) != 2 || snap["a"] != 1 {
+		t.Fatalf("visited %d, snapshot %v", n, snap)
+	}
+	if m.Len() != 2 || !m.Has("aa") || !m.Has("bb") {
+		t.Fatalf("after Range: %v", m.Snapshot())
+	}
+}
+
+//TestCOWMapUpdateAtomic Update 中的多个修改一起生效：读者看到的 from、to 之和始终不变
+func TestCOWMapUpdateAtomic(t *testing.T) {
+	m := _map.NewCOWMap(map[string]interface{}{"from": 100, "to": 0})
+	var stop int32
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&stop) == 0 {
+				snap := m.Snapshot()
+				if sum := snap["from"].(int) + snap["to"].(int); sum != 100 {
+					t.Errorf("from + to = %d", sum)
+					return
+				}
+				runtime.Gosched()
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		m.Update(func(m map[string]interface{}) bool {
+			m["from"] = m["from"].(int) - 1
+			m["to"] = m["to"].(int) + 1
+			return true
+		})
+		runtime.Gosched()
+	}
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+	if v, _ := m.Get("to"); v != 100 {
+		t.Fatalf("to = %v, want 100", v)
+	}
+}
+
+//BenchmarkLookup 一张 1000 项的查找表，所有 P 只读
+func BenchmarkLookup(b *testing.B) {
+	const size = 1000
+	keys := make([]string, size)
+	table := make(map[string]interface{}, size)
+	rw := _map.NewRWMap(size)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		table[keys[i]] = i
+		rw.Set(i, i)
+	}
+
+	b.Run("COWMap", func(b *testing.B) {
+		m := _map.NewCOWMap(table)
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				m.Get(keys[i%size])
+			}
+		})
+	})
+	b.Run("RWMap", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				rw.Get(i % size)
+			}
+		})
+	})
+	b.Run("sync.Map", func(b *testing.B) {
+		var m sync.Map
+		for k, v := range table {
+			m.Store(k, v)
+		}
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				m.Load(keys[i%size])
+			}
+		})
+	})
+}
@@ -1,8 +1,8 @@
 package _map
 
 import (
+	"encoding/json"
 	"fmt"
-	"hash/fnv"
 	"sync"
 )
 
@@ -26,19 +26,22 @@ func exampleMap()  {
 
 //map 扩展 可以支持并发读写
 
+//RWMap 的 key 可以是任何可比较的类型（和内置 map 的要求一样），value 可以是任何类型
 type RWMap struct {
 	sync.RWMutex //读写锁保护下面的map字段
-	m map[int]int
+	m            map[interface{}]interface{}
+	log          *Log       //不为 nil 时每次修改都追加一条日志，见 SetLog
+	snapshotMu   sync.Mutex //串行化 WriteSnapshot
 }
 
 //新建一个RWMap
-func NewRWMap(n int) *RWMap  {
+func NewRWMap(n int) *RWMap {
 	return &RWMap{
-		m : make(map[int]int, n),
+		m: make(map[interface{}]interface{}, n),
 	}
 }
 
-func (m *RWMap) Get(k int) (int, bool) { //从map中读取一个值
+func (m *RWMap) Get(k interface{}) (interface{}, bool) { //从map中读取一个值
 	m.RLock()
 	defer m.RUnlock()
 
@@ -47,42 +50,98 @@ func (m *RWMap) Get(k int) (int, bool) { //从map中读取一个值
 	return v, existed
 }
 
-func (m *RWMap) Set(k, v int)  { //设置一个键值对
+func (m *RWMap) Set(k, v interface{}) { //设置一个键值对
 	m.Lock()
 	defer m.Unlock()
 	m.m[k] = v
+	if m.log != nil {
+		m.log.Append(OpSet, k, v)
+	}
 }
 
-func (m *RWMap) Delete(k int) {
+func (m *RWMap) Delete(k interface{}) {
 	m.Lock()
 	defer m.Unlock()
+	if _, ok := m.m[k]; ok && m.log != nil {
+		m.log.Append(OpDelete, k, nil)
+	}
 	delete(m.m, k)
 }
 
-func (m *RWMap) Len() int  {
+func (m *RWMap) Len() int {
 	m.RLock()
 	defer m.RUnlock()
 
 	return len(m.m)
 }
 
-func (m *RWMap) Each(f func(k, v int) bool)  {
+//Snapshot 复制一份当前的内容，复制时持有读锁，返回的 map 归调用者所有
+func (m *RWMap) Snapshot() map[interface{}]interface{} {
 	m.RLock()
 	defer m.RUnlock()
 
+	snap := make(map[interface{}]interface{}, len(m.m))
 	for k, v := range m.m {
-		if ! f(k, v) {
+		snap[k] = v
+	}
+	return snap
+}
+
+//Range 遍历 Snapshot 得到的副本，f 返回 false 时停止。
+//调用 f 时不持有锁：f 里可以读写这个 RWMap，慢的 f 也不会挡住写者，但是遍历看不到 f 做的修改
+func (m *RWMap) Range(f func(k, v interface{}) bool) {
+	for k, v := range m.Snapshot() {
+		if !f(k, v) {
 			return
 		}
 	}
 }
 
+//Each 和 Range 相同，f 里可以调用 Set
+func (m *RWMap) Each(f func(k, v interface{}) bool) {
+	m.Range(f)
+}
+
+//Keys 所有的 key，顺序不确定
+func (m *RWMap) Keys() []interface{} {
+	m.RLock()
+	defer m.RUnlock()
+
+	keys := make([]interface{}, 0, len(m.m))
+	for k := range m.m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+//Values 所有的 value，顺序不确定
+func (m *RWMap) Values() []interface{} {
+	m.RLock()
+	defer m.RUnlock()
+
+	values := make([]interface{}, 0, len(m.m))
+	for _, v := range m.m {
+		values = append(values, v)
+	}
+	return values
+}
+
 //分片加锁：更高效的map,  减少锁的粒度 知名的实现方式 orcaman/concurrent-map
 
-var ShardCount = 32
+//DefaultShardCount New 默认的分片个数，只在创建时读取。请用 WithShardCount 给每个 map 单独指定。
+//原来叫 ShardCount，和方法 ConcurrentMap.ShardCount()（一个 map 实际的分片个数）同名、意思不同，所以改了名字
+var DefaultShardCount = 32
 
-//分成shardCount 个分片的map
-type ConcurrentMap []*ConcurrentMapShared
+//ConcurrentMap 分成多个分片的map，每个分片一把读写锁。是一个小的值类型，复制之后还是同一个 map
+//不兼容的修改：ConcurrentMap 原来是 []*ConcurrentMapShared，现在是结构体，
+//不能再用 m[i]、range m 访问分片，改用 GetShard(key)，遍历用 IterBuffered、Items
+type ConcurrentMap struct {
+	shards []*ConcurrentMapShared
+	hasher Hasher
+	log    *Log //不为 nil 时每次修改都在分片的锁内追加一条日志，见 WithLog
+	//snapshot 串行化 WriteSnapshot，复制之后仍然是同一把锁
+	snapshot *sync.Mutex
+}
 
 //通过RWMutex保护的线程安全的分片，包含一个map
 type ConcurrentMapShared struct {
@@ -90,21 +149,24 @@ type ConcurrentMapShared struct {
 	sync.RWMutex	//read write mutex,guards access to internal map
 }
 
-//创建并发map
-func New() ConcurrentMap {
-	m := make(ConcurrentMap, ShardCount)
-	for i:=0; i < ShardCount; i++ {
-		m[i] = &ConcurrentMapShared{items: make(map[string]interface{})}
+//创建并发map，默认 DefaultShardCount 个分片、使用 FNV1a 哈希
+func New(opts ...Option) ConcurrentMap {
+	o := newOptions(opts)
+	m := ConcurrentMap{shards: make([]*ConcurrentMapShared, o.shardCount), hasher: o.hasher, log: o.log, snapshot: &sync.Mutex{}}
+	for i := range m.shards {
+		m.shards[i] = &ConcurrentMapShared{items: make(map[string]interface{})}
 	}
 	return m
 }
 
-// 根据 key 计算分片索引
+//GetShard 根据 key 的哈希值选择分片
 func (m ConcurrentMap) GetShard(key string) *ConcurrentMapShared {
-	h := fnv.New32()
-	k, _ := h.Write([]byte(key))
+	return m.shards[shardIndex(m.hasher.Hash(key), len(m.shards))]
+}
 
-	return m[uint(k)%uint(ShardCount)]
+//ShardCount 分片个数
+func (m ConcurrentMap) ShardCount() int {
+	return len(m.shards)
 }
 
 func (m ConcurrentMap) Set(key string, value interface{}) {
@@ -112,6 +174,7 @@ func (m ConcurrentMap) Set(key string, value interface{}) {
 	shard := m.GetShard(key)
 	shard.Lock() //对这个分片加锁，执行业务操作
 	shard.items[key] = value
+	m.logSet(key, value)
 	shard.Unlock()
 }
 
@@ -124,4 +187,213 @@ func (m ConcurrentMap) Get(key string) (interface{}, bool) {
 	shard.RUnlock()
 
 	return val, ok
-}
\ No newline at end of file
+}
+
+//MSet 批量设置，每个 key 单独加锁，不是原子的
+func (m ConcurrentMap) MSet(data map[string]interface{}) {
+	for key, value := range data {
+		shard := m.GetShard(key)
+		shard.Lock()
+		shard.items[key] = value
+		m.logSet(key, value)
+		shard.Unlock()
+	}
+}
+
+//SetIfAbsent key 不存在时才设置，返回是否设置了
+func (m ConcurrentMap) SetIfAbsent(key string, value interface{}) bool {
+	shard := m.GetShard(key)
+	shard.Lock()
+	defer shard.Unlock()
+	if _, ok := shard.items[key]; ok {
+		return false
+	}
+	shard.items[key] = value
+	m.logSet(key, value)
+	return true
+}
+
+//UpsertCb Upsert 的回调，exist 表示 key 是否已经存在，valueInMap 是已经存在的值，返回要写入的值。
+//回调在分片的锁内执行，不能再访问同一个 ConcurrentMap
+type UpsertCb func(exist bool, valueInMap interface{}, newValue interface{}) interface{}
+
+//Upsert 插入或者更新：写入 cb 的返回值，并返回它
+func (m ConcurrentMap) Upsert(key string, value interface{}, cb UpsertCb) interface{} {
+	shard := m.GetShard(key)
+	shard.Lock()
+	defer shard.Unlock()
+	old, ok := shard.items[key]
+	res := cb(ok, old, value)
+	shard.items[key] = res
+	m.logSet(key, res)
+	return res
+}
+
+//Count 元素个数，依次对每个分片加读锁，并发修改时只是一个近似值
+func (m ConcurrentMap) Count() int {
+	count := 0
+	for _, shard := range m.shards {
+		shard.RLock()
+		count += len(shard.items)
+		shard.RUnlock()
+	}
+	return count
+}
+
+//IsEmpty 是否没有元素
+func (m ConcurrentMap) IsEmpty() bool {
+	return m.Count() == 0
+}
+
+//Has key 是否存在
+func (m ConcurrentMap) Has(key string) bool {
+	shard := m.GetShard(key)
+	shard.RLock()
+	_, ok := shard.items[key]
+	shard.RUnlock()
+	return ok
+}
+
+//Remove 删除 key
+func (m ConcurrentMap) Remove(key string) {
+	shard := m.GetShard(key)
+	shard.Lock()
+	if _, ok := shard.items[key]; ok {
+		delete(shard.items, key)
+		m.logDelete(key)
+	}
+	shard.Unlock()
+}
+
+//RemoveCb RemoveCb 方法的回调，在分片的锁内执行，返回 true 时删除 key。key 不存在时 exists 为 false、v 为 nil
+type RemoveCb func(key string, v interface{}, exists bool) bool
+
+//RemoveCb 由 cb 决定是否删除 key（比如值满足某个条件才删除），返回 cb 的结果
+func (m ConcurrentMap) RemoveCb(key string, cb RemoveCb) bool {
+	shard := m.GetShard(key)
+	shard.Lock()
+	defer shard.Unlock()
+	v, ok := shard.items[key]
+	remove := cb(key, v, ok)
+	if remove && ok {
+		delete(shard.items, key)
+		m.logDelete(key)
+	}
+	return remove
+}
+
+//Pop 删除 key 并返回它的值
+func (m ConcurrentMap) Pop(key string) (interface{}, bool) {
+	shard := m.GetShard(key)
+	shard.Lock()
+	v, ok := shard.items[key]
+	if ok {
+		delete(shard.items, key)
+		m.logDelete(key)
+	}
+	shard.Unlock()
+	return v, ok
+}
+
+//Clear 删除所有元素。有日志时先锁住所有分片，保证日志里 Clear 和其他修改的先后顺序与内存中一致
+func (m ConcurrentMap) Clear() {
+	if m.log != nil {
+		m.lockAll()
+		defer m.unlockAll()
+		for _, shard := range m.shards {
+			shard.items = make(map[string]interface{})
+		}
+		m.log.Append(OpClear, nil, nil)
+		return
+	}
+	for _, shard := range m.shards {
+		shard.Lock()
+		shard.items = make(map[string]interface{})
+		shard.Unlock()
+	}
+}
+
+//Tuple IterBuffered 返回的键值对
+type Tuple struct {
+	Key string
+	Val interface{}
+}
+
+//snapshot 依次复制每个分片，复制一个分片时只持有这个分片的读锁
+func snapshot(m ConcurrentMap) [][]Tuple {
+	tuples := make([][]Tuple, len(m.shards))
+	for i, shard := range m.shards {
+		shard.RLock()
+		tuples[i] = make([]Tuple, 0, len(shard.items))
+		for key, val := range shard.items {
+			tuples[i] = append(tuples[i], Tuple{key, val})
+		}
+		shard.RUnlock()
+	}
+	return tuples
+}
+
+//IterBuffered 返回一个带缓冲的 channel，包含调用时所有的键值对。
+//先复制所有分片再写入 channel，读取 channel 时不持有任何锁，可以在循环中修改 map
+func (m ConcurrentMap) IterBuffered() <-chan Tuple {
+	tuples := snapshot(m)
+	total := 0
+	for _, t := range tuples {
+		total += len(t)
+	}
+	ch := make(chan Tuple, total)
+	for _, t := range tuples {
+		for _, tuple := range t {
+			ch <- tuple
+		}
+	}
+	close(ch)
+	return ch
+}
+
+//IterCb 对每个键值对调用 fn，fn 在分片的读锁内执行，不能修改同一个 ConcurrentMap
+func (m ConcurrentMap) IterCb(fn func(key string, v interface{})) {
+	for _, shard := range m.shards {
+		shard.RLock()
+		for key, value := range shard.items {
+			fn(key, value)
+		}
+		shard.RUnlock()
+	}
+}
+
+//Items 所有键值对的副本
+func (m ConcurrentMap) Items() map[string]interface{} {
+	items := make(map[string]interface{}, m.Count())
+	m.IterCb(func(key string, v interface{}) {
+		items[key] = v
+	})
+	return items
+}
+
+//Keys 所有的 key
+func (m ConcurrentMap) Keys() []string {
+	keys := make([]string, 0, m.Count())
+	m.IterCb(func(key string, _ interface{}) {
+		keys = append(keys, key)
+	})
+	return keys
+}
+
+//MarshalJSON 编码成 JSON 对象
+func (m ConcurrentMap) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Items())
+}
+
+//UnmarshalJSON 把 JSON 对象中的键值对加入到 map 中，已有的元素保留；m 是零值时先用默认配置创建
+func (m *ConcurrentMap) UnmarshalJSON(b []byte) error {
+	var items map[string]interface{}
+	if err := json.Unmarshal(b, &items); err != nil {
+		return err
+	}
+	if m.shards == nil {
+		*m = New()
+	}
+	m.MSet(items)
+	return nil
+}
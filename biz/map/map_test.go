@@ -0,0 +1,152 @@
+package _map_test
+
+import (
+	"encoding/json"
+	_map "go-learn.com/v1/biz/map"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+//TestConcurrentMapBasic Set/Get/Has/Remove/Pop/Count/Clear
+func TestConcurrentMapBasic(t *testing.T) {
+	m := _map.New()
+	if !m.IsEmpty() {
+		t.Fatal("new map is not empty")
+	}
+	m.MSet(map[string]interface{}{"a": 1, "b": 2, "c": 3})
+	m.Remove("b")
+	m.Remove("x")
+	if m.Count() != 2 || m.Has("b") || !m.Has("a") {
+		t.Fatalf("after Remove: %v", m.Items())
+	}
+	if v, ok := m.Pop("a"); !ok || v != 1 || m.Has("a") {
+		t.Fatalf("Pop = %v, %v", v, ok)
+	}
+	if _, ok := m.Pop("a"); ok {
+		t.Fatal("Pop of a missing key succeeded")
+	}
+	m.Clear()
+	if !m.IsEmpty() {
+		t.Fatalf("after Clear: %v", m.Items())
+	}
+}
+
+//TestConcurrentMapConditional SetIfAbsent、Upsert、RemoveCb 在分片锁内判断和修改
+func TestConcurrentMapConditional(t *testing.T) {
+	m := _map.New()
+	if !m.SetIfAbsent("a", 1) || m.SetIfAbsent("a", 2) {
+		t.Fatal("SetIfAbsent")
+	}
+	if v, _ := m.Get("a"); v != 1 {
+		t.Fatalf("a = %v, want 1", v)
+	}
+
+	appendCb := func(exist bool, old, v interface{}) interface{} {
+		if !exist {
+			return []int{v.(int)}
+		}
+		return append(old.([]int), v.(int))
+	}
+	m.Upsert("list", 1, appendCb)
+	if got := m.Upsert("list", 2, appendCb); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Fatalf("Upsert = %v", got)
+	}
+
+	ifEven := func(key string, v interface{}, exists bool) bool {
+		return exists && v.(int)%2 == 0
+	}
+	if m.RemoveCb("a", ifEven) || !m.Has("a") {
+		t.Fatal("RemoveCb removed an odd value")
+	}
+	m.Set("a", 4)
+	if !m.RemoveCb("a", ifEven) || m.Has("a") {
+		t.Fatal("RemoveCb did not remove an even value")
+	}
+	if m.RemoveCb("missing", ifEven) {
+		t.Fatal("RemoveCb on a missing key returned true")
+	}
+}
+
+//TestConcurrentMapUpsertConcurrent 并发 Upsert 同一个 key 不会丢失更新
+func TestConcurrentMapUpsertConcurrent(t *testing.T) {
+	m := _map.New()
+	inc := func(exist bool, old, v interface{}) interface{} {
+		if !exist {
+			return v
+		}
+		return old.(int) + v.(int)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				m.Upsert("n", 1, inc)
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := m.Get("n"); v != 8000 {
+		t.Fatalf("n = %v, want 8000", v)
+	}
+}
+
+//TestConcurrentMapIter IterBuffered、IterCb、Keys、Items 都能看到所有元素；遍历 IterBuffered 时可以修改 map
+func TestConcurrentMapIter(t *testing.T) {
+	m := _map.New()
+	want := make(map[string]interface{})
+	for i := 0; i < 100; i++ {
+		want[strconv.Itoa(i)] = i
+	}
+	m.MSet(want)
+
+	got := make(map[string]interface{})
+	for tuple := range m.IterBuffered() {
+		got[tuple.Key] = tuple.Val
+		m.Remove(tuple.Key)
+	}
+	if !reflect.DeepEqual(got, want) || !m.IsEmpty() {
+		t.Fatalf("IterBuffered saw %d items, %d left", len(got), m.Count())
+	}
+
+	m.MSet(want)
+	if !reflect.DeepEqual(m.Items(), want) {
+		t.Fatal("Items differs")
+	}
+	n := 0
+	m.IterCb(func(key string, v interface{}) { n++ })
+	keys := m.Keys()
+	sort.Strings(keys)
+	if n != 100 || len(keys) != 100 || keys[0] != "0" || keys[99] != "99" {
+		t.Fatalf("IterCb visited %d, Keys = %d", n, len(keys))
+	}
+}
+
+//TestConcurrentMapJSON 编码成 JSON 对象，解码到 nil 的 ConcurrentMap 时会先创建
+func TestConcurrentMapJSON(t *testing.T) {
+	m := _map.New()
+	m.Set("a", "x")
+	m.Set("b", 2.5)
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"a":"x","b":2.5}` {
+		t.Fatalf("Marshal = %s", data)
+	}
+
+	var got _map.ConcurrentMap
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Items(), m.Items()) {
+		t.Fatalf("Unmarshal = %v", got.Items())
+	}
+	if err := json.Unmarshal([]byte(`[1]`), &got); err == nil {
+		t.Fatal("Unmarshal of an array succeeded")
+	}
+}
@@ -0,0 +1,384 @@
+package _map
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/**
+ @desc 持久化：某一时刻的快照文件，加上记录每次修改的追加日志，启动时先读快照再重放日志
+ @date 2026-10-18
+*/
+
+//日志和快照使用相同的记录格式：
+//4 字节长度 | 4 字节 CRC32(IEEE) | gob 编码的 Record
+//每条记录单独用一个 gob.Encoder 编码，可以单独解码，坏掉一条不影响定位后面的记录。
+//key、value 是 interface{}，基本类型 gob 已经注册过了，自定义的类型要先调用 gob.Register。
+//
+//每条日志记录有递增的序号 Seq，快照记录写快照时日志的序号：
+//恢复时先加载快照，再重放序号比它大的日志；写完快照之后，序号不大于它的日志就可以丢掉了（Compact）。
+//这样写快照和压缩日志之间崩溃也不会丢数据，只是重放的日志多一些。
+
+//Op 记录的类型
+type Op uint8
+
+const (
+	//OpSet 设置 Key 为 Value
+	OpSet Op = iota + 1
+	//OpDelete 删除 Key
+	OpDelete
+	//OpClear 删除所有元素
+	OpClear
+	//opSnapshot 快照文件的第一条记录，Seq 是快照对应的日志序号；
+	//压缩之后的日志也以它开头，重新打开日志时序号从它继续，不会和快照中的序号重复
+	opSnapshot
+)
+
+//Record 一条修改记录
+type Record struct {
+	Seq   uint64
+	Op    Op
+	Key   interface{}
+	Value interface{}
+}
+
+var (
+	//ErrCorrupt 记录的校验和不对，或者长度不合理
+	ErrCorrupt = errors.New("map: corrupt record")
+	//errTorn 文件末尾只写了一半的记录，通常是写日志的时候进程崩溃了
+	errTorn = errors.New("map: torn record")
+)
+
+//maxRecord 单条记录的长度上限，超过时认为长度字段已经坏了
+const maxRecord = 64 << 20
+
+func encodeRecord(r *Record) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 8))
+	if err := gob.NewEncoder(&buf).Encode(r); err != nil {
+		return nil, fmt.Errorf("map: encode record: %v", err)
+	}
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b[0:4], uint32(len(b)-8))
+	binary.BigEndian.PutUint32(b[4:8], crc32.ChecksumIEEE(b[8:]))
+	return b, nil
+}
+
+//readRecord 读取一条记录，返回记录和它占用的字节数。文件正好结束时返回 io.EOF
+func readRecord(r io.Reader) (*Record, int64, error) {
+	var header [8]byte
+	if n, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			return nil, int64(n), errTorn
+		}
+		return nil, 0, err
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxRecord {
+		return nil, 8, ErrCorrupt
+	}
+	payload := make([]byte, size)
+	if n, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, 8 + int64(n), errTorn
+		}
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 8 + int64(size), ErrCorrupt
+	}
+	rec := &Record{}
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(rec); err != nil {
+		return nil, 8 + int64(size), fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return rec, 8 + int64(size), nil
+}
+
+//Log 只追加的修改日志，所有方法都可以并发调用
+type Log struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	seq  uint64
+	err  error //第一次写失败的错误，之后的 Append 都返回它
+}
+
+//OpenLog 打开或者创建日志文件。末尾只写了一半的记录会被截掉；中间的记录坏了返回 ErrCorrupt
+func OpenLog(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("map: open log: %v", err)
+	}
+	l := &Log{path: path, f: f}
+	var good int64
+	err = scan(f, func(rec *Record, end int64) error {
+		l.seq, good = rec.Seq, end
+		return nil
+	})
+	if err == errTorn {
+		err = f.Truncate(good)
+	}
+	if err == nil {
+		_, err = f.Seek(good, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("map: open log %s: %w", path, err)
+	}
+	return l, nil
+}
+
+//scan 从头读取 r 中的每一条记录，fn 的 end 是这条记录结束的位置。记录坏了时返回的错误带有它的位置
+func scan(r io.Reader, fn func(rec *Record, end int64) error) error {
+	br := bufio.NewReader(r)
+	var off int64
+	for {
+		rec, n, err := readRecord(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err == errTorn {
+			return errTorn
+		}
+		if err != nil {
+			return fmt.Errorf("offset %d: %w", off, err)
+		}
+		off += n
+		if err := fn(rec, off); err != nil {
+			return err
+		}
+	}
+}
+
+//Append 追加一条记录，返回它的序号。每条记录一次 write 调用：进程崩溃不会丢失，掉电不丢需要调用 Sync
+func (l *Log) Append(op Op, key, value interface{}) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return 0, l.err
+	}
+	rec := &Record{Seq: l.seq + 1, Op: op, Key: key, Value: value}
+	b, err := encodeRecord(rec)
+	if err == nil {
+		_, err = l.f.Write(b)
+	}
+	if err != nil {
+		//编码失败（比如类型没有注册）也要停下来：少了这一条，重放出来的内容就不对了
+		l.err = fmt.Errorf("map: append log: %v", err)
+		return 0, l.err
+	}
+	l.seq = rec.Seq
+	return rec.Seq, nil
+}
+
+//Seq 最后一条记录的序号
+func (l *Log) Seq() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq
+}
+
+//Err 第一次写日志失败的错误。map 的写方法没有返回值，日志写失败之后需要通过它发现
+func (l *Log) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+//Sync 把日志刷到磁盘
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Sync()
+}
+
+//Replay 按顺序对序号大于 after 的记录调用 fn
+func (l *Log) Replay(after uint64, fn func(rec *Record) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.Open(l.path)
+	if err != nil {
+		return fmt.Errorf("map: replay log: %v", err)
+	}
+	defer f.Close()
+	err = scan(f, func(rec *Record, _ int64) error {
+		if rec.Seq <= after || rec.Op == opSnapshot {
+			return nil
+		}
+		return fn(rec)
+	})
+	if err != nil && err != errTorn {
+		return fmt.Errorf("map: replay log %s: %w", l.path, err)
+	}
+	return nil
+}
+
+//Compact 丢掉序号不大于 upTo 的记录（它们已经包含在快照里了）。先写新文件再替换，中途失败时旧日志不变
+func (l *Log) Compact(upTo uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("map: compact log: %v", err)
+	}
+	tmp, err := writeFileAtomic(l.path, func(w io.Writer) error {
+		write := func(rec *Record) error {
+			b, err := encodeRecord(rec)
+			if err == nil {
+				_, err = w.Write(b)
+			}
+			return err
+		}
+		if err := write(&Record{Seq: upTo, Op: opSnapshot}); err != nil {
+			return err
+		}
+		return scan(l.f, func(rec *Record, _ int64) error {
+			if rec.Seq <= upTo {
+				return nil
+			}
+			return write(rec)
+		})
+	})
+	if err != nil {
+		//回到末尾继续追加
+		if _, serr := l.f.Seek(0, io.SeekEnd); serr != nil {
+			l.err = fmt.Errorf("map: compact log: %v", serr)
+		}
+		return fmt.Errorf("map: compact log: %w", err)
+	}
+	l.f.Close()
+	l.f = tmp
+	if _, err := l.f.Seek(0, io.SeekEnd); err != nil {
+		l.err = fmt.Errorf("map: compact log: %v", err)
+		return l.err
+	}
+	return nil
+}
+
+//Close 关闭日志文件
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err == nil {
+		l.err = errors.New("map: log closed")
+	}
+	return l.f.Close()
+}
+
+//writeFileAtomic 把 write 写的内容先写到同目录的临时文件，刷盘之后改名为 path，返回打开的新文件
+//临时文件的名字是唯一的，同时写同一个 path 也不会写进同一个临时文件
+func writeFileAtomic(path string, write func(w io.Writer) error) (*os.File, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	err = f.Chmod(0644)
+	w := bufio.NewWriter(f)
+	if err == nil {
+		err = write(w)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	//改名要在目录上 fsync 才能保证掉电之后还在，有的平台不支持，忽略错误
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return f, nil
+}
+
+//writeSnapshot 写快照文件：第一条记录是 opSnapshot，之后每个键值对一条 OpSet
+func writeSnapshot(path string, seq uint64, each func(fn func(key, value interface{}) error) error) error {
+	f, err := writeFileAtomic(path, func(w io.Writer) error {
+		write := func(rec *Record) error {
+			b, err := encodeRecord(rec)
+			if err == nil {
+				_, err = w.Write(b)
+			}
+			return err
+		}
+		if err := write(&Record{Seq: seq, Op: opSnapshot}); err != nil {
+			return err
+		}
+		return each(func(key, value interface{}) error {
+			return write(&Record{Op: OpSet, Key: key, Value: value})
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("map: write snapshot %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+//readSnapshot 读快照文件，返回快照对应的日志序号；文件不存在时返回 0
+func readSnapshot(path string, fn func(key, value interface{}) error) (uint64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("map: read snapshot: %v", err)
+	}
+	defer f.Close()
+
+	var seq uint64
+	first := true
+	err = scan(f, func(rec *Record, _ int64) error {
+		if first {
+			if rec.Op != opSnapshot {
+				return fmt.Errorf("%w: missing snapshot header", ErrCorrupt)
+			}
+			seq, first = rec.Seq, false
+			return nil
+		}
+		return fn(rec.Key, rec.Value)
+	})
+	if err == errTorn {
+		err = fmt.Errorf("%w: truncated snapshot", ErrCorrupt) //快照是改名生效的，不应该只写了一半
+	}
+	if err != nil {
+		return 0, fmt.Errorf("map: read snapshot %s: %w", path, err)
+	}
+	return seq, nil
+}
+
+//replay 把一条日志记录应用到 set、del、clear 上
+func replay(rec *Record, set func(key, value interface{}) error, del func(key interface{}) error, clear func()) error {
+	switch rec.Op {
+	case OpSet:
+		return set(rec.Key, rec.Value)
+	case OpDelete:
+		return del(rec.Key)
+	case OpClear:
+		clear()
+		return nil
+	}
+	return fmt.Errorf("%w: unknown op %d at seq %d", ErrCorrupt, rec.Op, rec.Seq)
+}
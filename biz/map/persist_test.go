@@ -0,0 +1,242 @@
+package _map_test
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	_map "go-learn.com/v1/biz/map"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func openLog(t *testing.T, path string) *_map.Log {
+	l, err := _map.OpenLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+//restart 模拟重启：关闭日志，重新打开，恢复到一个新的 ConcurrentMap
+func restart(t *testing.T, l *_map.Log, dir string) (_map.ConcurrentMap, *_map.Log) {
+	if err := l.Err(); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	l = openLog(t, filepath.Join(dir, "map.log"))
+	m := _map.New(_map.WithLog(l))
+	if err := m.Restore(filepath.Join(dir, "map.snapshot"), l); err != nil {
+		t.Fatal(err)
+	}
+	return m, l
+}
+
+//TestConcurrentMapPersist 只有日志、快照加日志两种情况下，重启之后的内容和重启之前相同
+func TestConcurrentMapPersist(t *testing.T) {
+	dir := tempDir(t)
+	l := openLog(t, filepath.Join(dir, "map.log"))
+	m := _map.New(_map.WithLog(l))
+
+	m.Set("gone", 0)
+	m.Clear()
+	m.MSet(map[string]interface{}{"a": 1, "b": "two", "c": []byte("3")})
+	m.Remove("a")
+	m.SetIfAbsent("d", 4.5)
+	m.Upsert("b", "!", func(exist bool, old, v interface{}) interface{} { return old.(string) + v.(string) })
+	m.Pop("c")
+	m.Set("e", nil)
+	want := m.Items()
+
+	m, l = restart(t, l, dir)
+	if got := m.Items(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after replaying the log: %v, want %v", got, want)
+	}
+
+	if err := m.WriteSnapshot(filepath.Join(dir, "map.snapshot")); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	if err := l.Replay(0, func(*_map.Record) error { n++; return nil }); err != nil || n != 0 {
+		t.Fatalf("log has %d records after the snapshot (%v)", n, err)
+	}
+
+	//压缩之后马上重启，新的记录的序号要接着快照的序号，否则恢复时会被当成快照里已经有的
+	m, l = restart(t, l, dir)
+	if l.Seq() != 10 {
+		t.Fatalf("Seq = %d after compaction, want 10", l.Seq())
+	}
+	m.Set("f", int64(6))
+	m.Remove("d")
+	want = m.Items()
+
+	m, l = restart(t, l, dir)
+	defer l.Close()
+	if got := m.Items(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after snapshot + log: %v, want %v", got, want)
+	}
+	if l.Seq() != 12 {
+		t.Fatalf("Seq = %d, want 12", l.Seq())
+	}
+}
+
+//TestConcurrentSnapshots 并发的 WriteSnapshot 和 Set：快照文件不会被写乱，日志不会按更新的快照压缩之后又被旧的快照覆盖
+func TestConcurrentSnapshots(t *testing.T) {
+	dir := tempDir(t)
+	l := openLog(t, filepath.Join(dir, "map.log"))
+	m := _map.New(_map.WithLog(l))
+	snapPath := filepath.Join(dir, "map.snapshot")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				m.Set(fmt.Sprintf("%d-%d", w, i), i)
+				if i%10 == 0 {
+					if err := m.WriteSnapshot(snapPath); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	want := m.Items()
+
+	m, l = restart(t, l, dir)
+	defer l.Close()
+	if got := m.Items(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("restored %d items, want %d", len(got), len(want))
+	}
+	if files, _ := filepath.Glob(snapPath + ".*"); len(files) != 0 {
+		t.Fatalf("temporary files left behind: %v", files)
+	}
+}
+
+type account struct {
+	Owner   string
+	Balance int
+}
+
+func init() {
+	gob.Register(account{})
+}
+
+//TestRWMapPersist 任意类型的 key、value（自定义类型要 gob.Register）
+func TestRWMapPersist(t *testing.T) {
+	dir := tempDir(t)
+	logPath, snapPath := filepath.Join(dir, "rw.log"), filepath.Join(dir, "rw.snapshot")
+	l := openLog(t, logPath)
+	m := _map.NewRWMap(0)
+	m.SetLog(l)
+	m.Set(1, account{"alice", 10})
+	m.Set("x", true)
+	if err := m.WriteSnapshot(snapPath); err != nil {
+		t.Fatal(err)
+	}
+	m.Set(2, account{"bob", 20})
+	m.Delete("x")
+	want := m.Snapshot()
+	l.Close()
+
+	l = openLog(t, logPath)
+	defer l.Close()
+	got := _map.NewRWMap(0)
+	if err := got.Restore(snapPath, l); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Snapshot(), want) {
+		t.Fatalf("restored %v, want %v", got.Snapshot(), want)
+	}
+}
+
+//TestLogTornTail 末尾只写了一半的记录在打开时被截掉，之后可以继续追加
+func TestLogTornTail(t *testing.T) {
+	path := filepath.Join(tempDir(t), "map.log")
+	l := openLog(t, path)
+	l.Append(_map.OpSet, "a", 1)
+	l.Append(_map.OpSet, "b", 2)
+	l.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	full := len(data)
+	if err := ioutil.WriteFile(path, data[:full-3], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l = openLog(t, path)
+	defer l.Close()
+	if l.Seq() != 1 {
+		t.Fatalf("Seq = %d after a torn record, want 1", l.Seq())
+	}
+	if seq, err := l.Append(_map.OpDelete, "a", nil); seq != 2 || err != nil {
+		t.Fatalf("Append = %d, %v", seq, err)
+	}
+	var ops []_map.Op
+	l.Replay(0, func(rec *_map.Record) error {
+		ops = append(ops, rec.Op)
+		return nil
+	})
+	if !reflect.DeepEqual(ops, []_map.Op{_map.OpSet, _map.OpDelete}) {
+		t.Fatalf("replayed %v", ops)
+	}
+	if err := l.Replay(1, func(rec *_map.Record) error {
+		if rec.Seq <= 1 {
+			t.Fatalf("Replay(1) returned seq %d", rec.Seq)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//TestLogCorrupt 中间的记录校验和不对时返回 ErrCorrupt，不会当作正常结束
+func TestLogCorrupt(t *testing.T) {
+	path := filepath.Join(tempDir(t), "map.log")
+	l := openLog(t, path)
+	l.Append(_map.OpSet, "a", "aaaaaaaa")
+	l.Append(_map.OpSet, "b", 2)
+	l.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	data[len(data)/4] ^= 0xff
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := _map.OpenLog(path); !errors.Is(err, _map.ErrCorrupt) {
+		t.Fatalf("OpenLog = %v, want ErrCorrupt", err)
+	}
+}
+
+//TestLogUnregisteredType 没有注册的类型写不进日志，之后的修改也不再写，通过 Err 报告
+func TestLogUnregisteredType(t *testing.T) {
+	type secret struct{ X int }
+	l := openLog(t, filepath.Join(tempDir(t), "map.log"))
+	defer l.Close()
+	m := _map.New(_map.WithLog(l))
+	m.Set("a", secret{1})
+	m.Set("b", 2)
+	if l.Err() == nil || l.Seq() != 0 {
+		t.Fatalf("Err = %v, Seq = %d", l.Err(), l.Seq())
+	}
+}
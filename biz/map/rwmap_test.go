@@ -0,0 +1,110 @@
+package _map_test
+
+import (
+	_map "go-learn.com/v1/biz/map"
+	"sort"
+	"testing"
+	"time"
+)
+
+//TestRWMapTypes key 可以是任何可比较的类型，value 可以是任何类型
+func TestRWMapTypes(t *testing.T) {
+	type pos struct{ x, y int }
+	m := _map.NewRWMap(0)
+	m.Set("a", []int{1})
+	m.Set(pos{1, 2}, "p")
+	m.Set(3, nil)
+	if v, ok := m.Get(pos{1, 2}); !ok || v != "p" {
+		t.Fatalf("Get(pos) = %v, %v", v, ok)
+	}
+	if v, ok := m.Get(3); !ok || v != nil {
+		t.Fatalf("Get(3) = %v, %v", v, ok)
+	}
+	m.Delete("a")
+	if _, ok := m.Get("a"); ok || m.Len() != 2 {
+		t.Fatal("Delete")
+	}
+}
+
+//TestRWMapKeysValues Keys、Values、Snapshot 的内容一致，Snapshot 是独立的副本
+func TestRWMapKeysValues(t *testing.T) {
+	m := _map.NewRWMap(0)
+	for i := 0; i < 5; i++ {
+		m.Set(i, i*10)
+	}
+	var keys, values []int
+	for _, k := range m.Keys() {
+		keys = append(keys, k.(int))
+	}
+	for _, v := range m.Values() {
+		values = append(values, v.(int))
+	}
+	sort.Ints(keys)
+	sort.Ints(values)
+	if len(keys) != 5 || keys[4] != 4 || len(values) != 5 || values[4] != 40 {
+		t.Fatalf("Keys = %v, Values = %v", keys, values)
+	}
+
+	snap := m.Snapshot()
+	snap[100] = 1
+	m.Set(0, -1)
+	if m.Len() != 5 || snap[0] != 0 {
+		t.Fatal("Snapshot is not a copy")
+	}
+}
+
+//TestRWMapRangeWrites Range、Each 的回调里可以写同一个 RWMap，遍历的是调用时的副本
+func TestRWMapRangeWrites(t *testing.T) {
+	m := _map.NewRWMap(0)
+	m.Set(1, 1)
+	m.Set(2, 2)
+
+	done := make(chan int)
+	go func() {
+		n := 0
+		m.Range(func(k, v interface{}) bool {
+			m.Set(k.(int)+10, v)
+			n++
+			return true
+		})
+		m.Each(func(k, v interface{}) bool {
+			m.Delete(k)
+			n++
+			return false
+		})
+		done <- n
+	}()
+	select {
+	case n := <-done:
+		if n != 3 || m.Len() != 3 {
+			t.Fatalf("visited %d, Len = %d", n, m.Len())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("writing from a Range callback deadlocked")
+	}
+}
+
+//TestRWMapSlowRange 慢的回调不会挡住写者
+func TestRWMapSlowRange(t *testing.T) {
+	m := _map.NewRWMap(0)
+	m.Set(1, 1)
+	inside, release := make(chan struct{}), make(chan struct{})
+	go m.Range(func(k, v interface{}) bool {
+		close(inside)
+		<-release
+		return true
+	})
+	defer close(release)
+
+	<-inside
+	written := make(chan struct{})
+	go func() {
+		m.Set(2, 2)
+		close(written)
+	}()
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Set blocked behind a Range callback")
+	}
+}
@@ -0,0 +1,226 @@
+package _map
+
+import (
+	"fmt"
+	"sync"
+)
+
+/**
+ @desc 分片的配置：分片个数、哈希函数，以及支持非 string key 的 KeyedMap
+ @date 2026-10-18
+*/
+
+//Hasher 计算 string key 的 32 位哈希值，分片按哈希值取模选择
+type Hasher interface {
+	Hash(key string) uint32
+}
+
+//HasherFunc 把普通函数转换成 Hasher
+type HasherFunc func(key string) uint32
+
+//Hash 调用 f(key)
+func (f HasherFunc) Hash(key string) uint32 {
+	return f(key)
+}
+
+const (
+	offset32 = 2166136261
+	prime32  = 16777619
+)
+
+//FNV1a 默认的 Hasher，32 位的 FNV-1a。和 hash/fnv 的结果相同，但不分配内存
+var FNV1a Hasher = HasherFunc(fnv1a)
+
+func fnv1a(key string) uint32 {
+	h := uint32(offset32)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= prime32
+	}
+	return h
+}
+
+//KeyHasher KeyedMap 中非 string、非整数的 key 要实现它，自己计算哈希值。
+//相等的 key 必须返回相同的哈希值
+type KeyHasher interface {
+	HashKey() uint32
+}
+
+//HashKey 计算 KeyedMap 的 key 的哈希值：string 用 h，整数用 mix32 打散，其他类型必须实现 KeyHasher
+func HashKey(h Hasher, key interface{}) uint32 {
+	switch k := key.(type) {
+	case KeyHasher:
+		return k.HashKey()
+	case string:
+		return h.Hash(k)
+	case int:
+		return mix64(uint64(k))
+	case int8:
+		return mix64(uint64(k))
+	case int16:
+		return mix64(uint64(k))
+	case int32:
+		return mix64(uint64(k))
+	case int64:
+		return mix64(uint64(k))
+	case uint:
+		return mix64(uint64(k))
+	case uint8:
+		return mix64(uint64(k))
+	case uint16:
+		return mix64(uint64(k))
+	case uint32:
+		return mix64(uint64(k))
+	case uint64:
+		return mix64(k)
+	case uintptr:
+		return mix64(uint64(k))
+	}
+	panic(fmt.Sprintf("map: key of type %T must be a string, an integer or implement KeyHasher", key))
+}
+
+//mix64 splitmix64 的最后一步，连续的整数也能均匀地分散到各个分片
+func mix64(x uint64) uint32 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return uint32(x)
+}
+
+//shardIndex 哈希值对应的分片下标
+func shardIndex(hash uint32, n int) int {
+	return int(hash % uint32(n))
+}
+
+//Option 创建分片 map 时的选项
+type Option func(*options)
+
+type options struct {
+	shardCount int
+	hasher     Hasher
+	log        *Log
+}
+
+//WithShardCount 指定分片个数，n 必须是正数
+func WithShardCount(n int) Option {
+	if n <= 0 {
+		panic("map: shard count must be positive")
+	}
+	return func(o *options) { o.shardCount = n }
+}
+
+//WithHasher 指定 string key 的哈希函数
+func WithHasher(h Hasher) Option {
+	return func(o *options) { o.hasher = h }
+}
+
+//WithLog New 创建的 ConcurrentMap 把每次修改追加到 l，见 ConcurrentMap.Restore。其他类型忽略这个选项
+func WithLog(l *Log) Option {
+	return func(o *options) { o.log = l }
+}
+
+func newOptions(opts []Option) options {
+	o := options{shardCount: DefaultShardCount, hasher: FNV1a}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.shardCount <= 0 {
+		o.shardCount = 32
+	}
+	return o
+}
+
+//KeyedMap 和 ConcurrentMap 一样分片加锁，key 可以是 string、整数或者实现了 KeyHasher 的类型
+type KeyedMap struct {
+	shards []*keyedShard
+	hasher Hasher
+}
+
+type keyedShard struct {
+	sync.RWMutex
+	items map[interface{}]interface{}
+}
+
+//NewKeyedMap 创建 KeyedMap，选项和 New 相同
+func NewKeyedMap(opts ...Option) *KeyedMap {
+	o := newOptions(opts)
+	m := &KeyedMap{shards: make([]*keyedShard, o.shardCount), hasher: o.hasher}
+	for i := range m.shards {
+		m.shards[i] = &keyedShard{items: make(map[interface{}]interface{})}
+	}
+	return m
+}
+
+func (m *KeyedMap) shard(key interface{}) *keyedShard {
+	return m.shards[shardIndex(HashKey(m.hasher, key), len(m.shards))]
+}
+
+//Set 设置一个键值对
+func (m *KeyedMap) Set(key, value interface{}) {
+	shard := m.shard(key)
+	shard.Lock()
+	shard.items[key] = value
+	shard.Unlock()
+}
+
+//Get 读取 key 对应的值
+func (m *KeyedMap) Get(key interface{}) (interface{}, bool) {
+	shard := m.shard(key)
+	shard.RLock()
+	v, ok := shard.items[key]
+	shard.RUnlock()
+	return v, ok
+}
+
+//Has key 是否存在
+func (m *KeyedMap) Has(key interface{}) bool {
+	_, ok := m.Get(key)
+	return ok
+}
+
+//Remove 删除 key
+func (m *KeyedMap) Remove(key interface{}) {
+	shard := m.shard(key)
+	shard.Lock()
+	delete(shard.items, key)
+	shard.Unlock()
+}
+
+//Pop 删除 key 并返回它的值
+func (m *KeyedMap) Pop(key interface{}) (interface{}, bool) {
+	shard := m.shard(key)
+	shard.Lock()
+	v, ok := shard.items[key]
+	delete(shard.items, key)
+	shard.Unlock()
+	return v, ok
+}
+
+//Count 元素个数，并发修改时只是一个近似值
+func (m *KeyedMap) Count() int {
+	count := 0
+	for _, shard := range m.shards {
+		shard.RLock()
+		count += len(shard.items)
+		shard.RUnlock()
+	}
+	return count
+}
+
+//IterCb 对每个键值对调用 fn，fn 在分片的读锁内执行，不能修改同一个 KeyedMap
+func (m *KeyedMap) IterCb(fn func(key, v interface{})) {
+	for _, shard := range m.shards {
+		shard.RLock()
+		for key, value := range shard.items {
+			fn(key, value)
+		}
+		shard.RUnlock()
+	}
+}
+
+//ShardCount 分片个数
+func (m *KeyedMap) ShardCount() int {
+	return len(m.shards)
+}
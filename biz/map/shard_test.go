@@ -0,0 +1,116 @@
+package _map_test
+
+import (
+	_map "go-learn.com/v1/biz/map"
+	"hash/fnv"
+	"strconv"
+	"testing"
+)
+
+//TestFNV1a 和 hash/fnv 的 FNV-1a 结果相同
+func TestFNV1a(t *testing.T) {
+	for _, key := range []string{"", "a", "foo", "中文", "key-12345"} {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		if got, want := _map.FNV1a.Hash(key), h.Sum32(); got != want {
+			t.Errorf("FNV1a(%q) = %x, want %x", key, got, want)
+		}
+	}
+}
+
+//checkSpread 每个分片分到的 key 数和平均值相差不超过 10%
+func checkSpread(t *testing.T, counts map[interface{}]int, shards, keys int) {
+	t.Helper()
+	if len(counts) != shards {
+		t.Fatalf("keys landed in %d of %d shards", len(counts), shards)
+	}
+	mean := float64(keys) / float64(shards)
+	for _, n := range counts {
+		if d := float64(n) - mean; d > mean/10 || d < -mean/10 {
+			t.Fatalf("shard has %d keys, mean %.0f: %v", n, mean, counts)
+		}
+	}
+}
+
+//TestConcurrentMapDistribution key 均匀地分散到各个分片，长度相同的 key 不会落在同一个分片
+func TestConcurrentMapDistribution(t *testing.T) {
+	const keys = 100000
+	for _, shards := range []int{7, 32, 64} {
+		m := _map.New(_map.WithShardCount(shards))
+		if m.ShardCount() != shards {
+			t.Fatalf("ShardCount = %d, want %d", m.ShardCount(), shards)
+		}
+		counts := make(map[interface{}]int)
+		for i := 0; i < keys; i++ {
+			counts[m.GetShard("key-"+strconv.Itoa(i))]++
+		}
+		checkSpread(t, counts, shards, keys)
+	}
+
+	m := _map.New()
+	same := make(map[interface{}]int)
+	for c := 'a'; c <= 'z'; c++ {
+		same[m.GetShard(string(c))]++
+	}
+	if len(same) < 10 {
+		t.Fatalf("26 one-letter keys landed in only %d shards", len(same))
+	}
+}
+
+//TestWithHasher 使用自定义的 Hasher
+func TestWithHasher(t *testing.T) {
+	calls := 0
+	m := _map.New(_map.WithShardCount(4), _map.WithHasher(_map.HasherFunc(func(key string) uint32 {
+		calls++
+		return uint32(len(key))
+	})))
+	m.Set("ab", 1)
+	if m.GetShard("ab") != m.GetShard("cd") || m.GetShard("ab") == m.GetShard("abc") {
+		t.Fatal("custom hasher was not used")
+	}
+	if v, ok := m.Get("ab"); !ok || v != 1 || calls == 0 {
+		t.Fatalf("Get = %v, %v, hasher calls %d", v, ok, calls)
+	}
+}
+
+//point 实现了 KeyHasher 的 key
+type point struct{ x, y int }
+
+func (p point) HashKey() uint32 { return _map.FNV1a.Hash(strconv.Itoa(p.x) + "," + strconv.Itoa(p.y)) }
+
+//TestKeyedMap string、整数、KeyHasher 的 key；连续的整数也均匀分布；不支持的 key 类型 panic
+func TestKeyedMap(t *testing.T) {
+	m := _map.NewKeyedMap(_map.WithShardCount(16))
+	m.Set("a", 1)
+	m.Set(42, 2)
+	m.Set(uint8(42), 3) //类型不同，是另一个 key
+	m.Set(point{1, 2}, 4)
+	if v, _ := m.Get(point{1, 2}); v != 4 || m.Count() != 4 {
+		t.Fatalf("Get(point) = %v, Count = %d", v, m.Count())
+	}
+	if v, ok := m.Pop(42); !ok || v != 2 || m.Has(42) || !m.Has(uint8(42)) {
+		t.Fatalf("Pop(42) = %v, %v", v, ok)
+	}
+	m.Remove("a")
+	n := 0
+	m.IterCb(func(key, v interface{}) { n++ })
+	if n != 2 {
+		t.Fatalf("IterCb visited %d, want 2", n)
+	}
+
+	const keys = 100000
+	for _, shards := range []int{16, 64} {
+		counts := make(map[interface{}]int)
+		for i := 0; i < keys; i++ {
+			counts[_map.HashKey(_map.FNV1a, i)%uint32(shards)]++
+		}
+		checkSpread(t, counts, shards, keys)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("unsupported key type did not panic")
+		}
+	}()
+	m.Set(1.5, 0)
+}
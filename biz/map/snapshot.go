@@ -0,0 +1,173 @@
+package _map
+
+import "fmt"
+
+//ConcurrentMap、RWMap 的快照和日志。启动时：
+//l, err := OpenLog(dir + "/map.log")
+//m := New(WithLog(l))
+//err = m.Restore(dir+"/map.snapshot", l)
+//之后定期（或者日志太大时）调用 m.WriteSnapshot(dir+"/map.snapshot")，写完之后日志里已经包含在快照中的部分会被丢掉。
+//同一个 map 的 WriteSnapshot 是串行的：复制、写文件、改名、压缩日志都在一把锁内完成，
+//否则两次快照重叠时旧的快照可能后改名，覆盖掉新的快照，而日志已经按新的快照压缩，中间的记录就永远丢了。
+//快照和日志必须成对使用：快照里记录的是日志的序号，换一个日志文件重放的结果是错的。
+
+func (m ConcurrentMap) logSet(key string, value interface{}) {
+	if m.log != nil {
+		m.log.Append(OpSet, key, value)
+	}
+}
+
+func (m ConcurrentMap) logDelete(key string) {
+	if m.log != nil {
+		m.log.Append(OpDelete, key, nil)
+	}
+}
+
+//lockAll 按顺序锁住所有分片，所有的修改都停下来
+func (m ConcurrentMap) lockAll() {
+	for _, shard := range m.shards {
+		shard.Lock()
+	}
+}
+
+func (m ConcurrentMap) unlockAll() {
+	for _, shard := range m.shards {
+		shard.Unlock()
+	}
+}
+
+//WriteSnapshot 把某一时刻的内容写到 path：复制时同时持有所有分片的读锁，得到的是一致的快照。
+//有日志时记下日志的序号，写完快照之后压缩日志
+func (m ConcurrentMap) WriteSnapshot(path string) error {
+	m.snapshot.Lock()
+	defer m.snapshot.Unlock()
+
+	for _, shard := range m.shards {
+		shard.RLock()
+	}
+	var seq uint64
+	if m.log != nil {
+		seq = m.log.Seq() //修改都在分片的写锁内写日志，现在不会有新的日志
+	}
+	items := make(map[string]interface{})
+	for _, shard := range m.shards {
+		for k, v := range shard.items {
+			items[k] = v
+		}
+		shard.RUnlock()
+	}
+
+	err := writeSnapshot(path, seq, func(fn func(key, value interface{}) error) error {
+		for k, v := range items {
+			if err := fn(k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || m.log == nil {
+		return err
+	}
+	return m.log.Compact(seq)
+}
+
+//Restore 加载 path 的快照（文件不存在时当作空的），再重放 l 中比快照新的记录；l 可以为 nil。
+//应该在 map 开始使用之前调用，恢复的过程不会再写日志
+func (m ConcurrentMap) Restore(path string, l *Log) error {
+	m.lockAll()
+	defer m.unlockAll()
+
+	set := func(key, value interface{}) error {
+		k, err := stringKey(key)
+		if err == nil {
+			m.GetShard(k).items[k] = value
+		}
+		return err
+	}
+	seq, err := readSnapshot(path, set)
+	if err != nil || l == nil {
+		return err
+	}
+	return l.Replay(seq, func(rec *Record) error {
+		return replay(rec, set, func(key interface{}) error {
+			k, err := stringKey(key)
+			if err == nil {
+				delete(m.GetShard(k).items, k)
+			}
+			return err
+		}, func() {
+			for _, shard := range m.shards {
+				shard.items = make(map[string]interface{})
+			}
+		})
+	})
+}
+
+func stringKey(key interface{}) (string, error) {
+	k, ok := key.(string)
+	if !ok {
+		return "", fmt.Errorf("map: restore: key %v of type %T is not a string", key, key)
+	}
+	return k, nil
+}
+
+//SetLog 之后的每次修改都追加到 l，l 为 nil 时停止记录。见 Restore
+func (m *RWMap) SetLog(l *Log) {
+	m.Lock()
+	m.log = l
+	m.Unlock()
+}
+
+//WriteSnapshot 把某一时刻的内容写到 path，有日志时写完之后压缩日志
+func (m *RWMap) WriteSnapshot(path string) error {
+	m.snapshotMu.Lock()
+	defer m.snapshotMu.Unlock()
+
+	m.RLock()
+	var seq uint64
+	if m.log != nil {
+		seq = m.log.Seq()
+	}
+	l := m.log
+	items := make(map[interface{}]interface{}, len(m.m))
+	for k, v := range m.m {
+		items[k] = v
+	}
+	m.RUnlock()
+
+	err := writeSnapshot(path, seq, func(fn func(key, value interface{}) error) error {
+		for k, v := range items {
+			if err := fn(k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || l == nil {
+		return err
+	}
+	return l.Compact(seq)
+}
+
+//Restore 加载 path 的快照（文件不存在时当作空的），再重放 l 中比快照新的记录；l 可以为 nil。恢复的过程不会再写日志
+func (m *RWMap) Restore(path string, l *Log) error {
+	m.Lock()
+	defer m.Unlock()
+
+	set := func(key, value interface{}) error {
+		m.m[key] = value
+		return nil
+	}
+	seq, err := readSnapshot(path, set)
+	if err != nil || l == nil {
+		return err
+	}
+	return l.Replay(seq, func(rec *Record) error {
+		return replay(rec, set, func(key interface{}) error {
+			delete(m.m, key)
+			return nil
+		}, func() {
+			m.m = make(map[interface{}]interface{})
+		})
+	})
+}
@@ -0,0 +1,238 @@
+package _map
+
+import (
+	"sync"
+	"time"
+)
+
+/**
+ @desc 带过期时间的分片 map：每个分片一个清理 goroutine，过期时回调，Close 停止所有清理 goroutine
+ @date 2026-10-18
+*/
+
+//过期的元素有两种处理：Get 时发现已经过期就当作不存在（只读，不加写锁），
+//清理 goroutine 每隔 CleanupInterval 扫描自己的分片，删除过期的元素并调用 OnEvict。
+//每个分片单独清理，扫描一个分片时只锁住这一个分片，其他分片的读写不受影响。
+
+//Clock 提供当前时间和清理 goroutine 的定时器，测试时可以换成手动拨动的时钟，拨动时钟就能驱动清理
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+//Ticker 和 time.Ticker 一样每隔一段时间向 C() 发送一次当前时间，接收方来不及处理时丢弃
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTicker(d time.Duration) Ticker { return systemTicker{time.NewTicker(d)} }
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.Ticker.C }
+
+//SystemClock 使用 time.Now 的 Clock
+var SystemClock Clock = systemClock{}
+
+//TTLOptions TTLMap 的配置
+type TTLOptions struct {
+	//DefaultTTL Set 使用的过期时间，0 表示不过期
+	DefaultTTL time.Duration
+	//CleanupInterval 清理 goroutine 扫描的间隔，0 表示不启动清理 goroutine（可以手动调用 DeleteExpired）
+	CleanupInterval time.Duration
+	//Clock 默认是 SystemClock
+	Clock Clock
+	//OnEvict 过期的元素被删除之后调用，不持有任何锁，可以访问 TTLMap
+	OnEvict func(key string, value interface{})
+}
+
+//TTLMap 带过期时间的分片 map，需要通过 NewTTLMap 创建，不再使用时调用 Close
+type TTLMap struct {
+	shards []*ttlShard
+	hasher Hasher
+	opts   TTLOptions
+
+	stop      chan struct{}
+	closeOnce sync.Once
+	janitors  sync.WaitGroup
+}
+
+type ttlShard struct {
+	sync.RWMutex
+	items map[string]ttlItem
+}
+
+type ttlItem struct {
+	value   interface{}
+	expires int64 //UnixNano，0 表示不过期
+}
+
+func (it ttlItem) expired(now int64) bool {
+	return it.expires != 0 && now >= it.expires
+}
+
+//NewTTLMap 创建 TTLMap，分片的选项和 New 相同
+func NewTTLMap(o TTLOptions, opts ...Option) *TTLMap {
+	if o.Clock == nil {
+		o.Clock = SystemClock
+	}
+	so := newOptions(opts)
+	m := &TTLMap{shards: make([]*ttlShard, so.shardCount), hasher: so.hasher, opts: o, stop: make(chan struct{})}
+	for i := range m.shards {
+		m.shards[i] = &ttlShard{items: make(map[string]ttlItem)}
+	}
+	if o.CleanupInterval > 0 {
+		for _, shard := range m.shards {
+			//定时器在返回之前创建好，之后拨动时钟一定能触发清理
+			m.janitors.Add(1)
+			go m.janitor(shard, o.Clock.NewTicker(o.CleanupInterval))
+		}
+	}
+	return m
+}
+
+func (m *TTLMap) shard(key string) *ttlShard {
+	return m.shards[shardIndex(m.hasher.Hash(key), len(m.shards))]
+}
+
+func (m *TTLMap) now() int64 {
+	return m.opts.Clock.Now().UnixNano()
+}
+
+//Set 使用 DefaultTTL 设置键值对
+func (m *TTLMap) Set(key string, value interface{}) {
+	m.SetWithTTL(key, value, m.opts.DefaultTTL)
+}
+
+//SetWithTTL 设置键值对，ttl 之后过期；ttl 为 0 表示不过期。
+//ttl 为负数（比如 deadline.Sub(now) 已经过了）表示写入时就已经过期：不保存 value，key 原来的值也被删除，不调用 OnEvict
+func (m *TTLMap) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	shard := m.shard(key)
+	if ttl < 0 {
+		shard.Lock()
+		delete(shard.items, key)
+		shard.Unlock()
+		return
+	}
+	it := ttlItem{value: value}
+	if ttl > 0 {
+		it.expires = m.now() + int64(ttl)
+	}
+	shard.Lock()
+	shard.items[key] = it
+	shard.Unlock()
+}
+
+//Get 读取 key 对应的值，已经过期的当作不存在
+func (m *TTLMap) Get(key string) (interface{}, bool) {
+	v, _, ok := m.GetWithTTL(key)
+	return v, ok
+}
+
+//GetWithTTL 读取 key 对应的值和剩余的过期时间，不过期的元素剩余时间是 0
+func (m *TTLMap) GetWithTTL(key string) (interface{}, time.Duration, bool) {
+	now := m.now()
+	shard := m.shard(key)
+	shard.RLock()
+	it, ok := shard.items[key]
+	shard.RUnlock()
+	if !ok || it.expired(now) {
+		return nil, 0, false
+	}
+	var ttl time.Duration
+	if it.expires != 0 {
+		ttl = time.Duration(it.expires - now)
+	}
+	return it.value, ttl, true
+}
+
+//Has key 是否存在并且没有过期
+func (m *TTLMap) Has(key string) bool {
+	_, _, ok := m.GetWithTTL(key)
+	return ok
+}
+
+//Delete 删除 key，不调用 OnEvict
+func (m *TTLMap) Delete(key string) {
+	shard := m.shard(key)
+	shard.Lock()
+	delete(shard.items, key)
+	shard.Unlock()
+}
+
+//Count 没有过期的元素个数
+func (m *TTLMap) Count() int {
+	now := m.now()
+	count := 0
+	for _, shard := range m.shards {
+		shard.RLock()
+		for _, it := range shard.items {
+			if !it.expired(now) {
+				count++
+			}
+		}
+		shard.RUnlock()
+	}
+	return count
+}
+
+//DeleteExpired 删除所有分片中过期的元素，返回删除的个数
+func (m *TTLMap) DeleteExpired() int {
+	n := 0
+	for _, shard := range m.shards {
+		n += m.deleteExpired(shard)
+	}
+	return n
+}
+
+type evicted struct {
+	key   string
+	value interface{}
+}
+
+func (m *TTLMap) deleteExpired(shard *ttlShard) int {
+	now := m.now()
+	var expired []evicted
+	shard.Lock()
+	for key, it := range shard.items {
+		if it.expired(now) {
+			delete(shard.items, key)
+			expired = append(expired, evicted{key, it.value})
+		}
+	}
+	shard.Unlock()
+
+	if m.opts.OnEvict != nil {
+		for _, e := range expired {
+			m.opts.OnEvict(e.key, e.value)
+		}
+	}
+	return len(expired)
+}
+
+//janitor 一个分片的清理 goroutine
+func (m *TTLMap) janitor(shard *ttlShard, ticker Ticker) {
+	defer m.janitors.Done()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			m.deleteExpired(shard)
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+//Close 停止清理 goroutine 并等待它们退出，可以多次调用。Close 之后仍然可以读写，只是不再自动清理
+func (m *TTLMap) Close() {
+	m.closeOnce.Do(func() { close(m.stop) })
+	m.janitors.Wait()
+}
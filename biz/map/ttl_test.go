@@ -0,0 +1,166 @@
+package _map_test
+
+import (
+	_map "go-learn.com/v1/biz/map"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+//fakeClock 手动拨动的时钟，Advance 时触发到期的 ticker
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+type fakeTicker struct {
+	clock   *fakeClock
+	c       chan time.Time
+	period  time.Duration
+	next    time.Time
+	stopped bool
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	t.stopped = true
+	t.clock.mu.Unlock()
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) _map.Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{clock: c, c: make(chan time.Time, 1), period: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		if t.stopped || t.next.After(c.now) {
+			continue
+		}
+		for !t.next.After(c.now) {
+			t.next = t.next.Add(t.period)
+		}
+		select {
+		case t.c <- c.now:
+		default:
+		}
+	}
+}
+
+//TestTTLMap 过期的元素读不到；DeleteExpired 删除过期的元素并调用 OnEvict，Delete 不调用
+func TestTTLMap(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	var evicted []string
+	m := _map.NewTTLMap(_map.TTLOptions{
+		DefaultTTL: time.Minute,
+		Clock:      clock,
+		OnEvict:    func(key string, value interface{}) { evicted = append(evicted, key) },
+	}, _map.WithShardCount(4))
+	defer m.Close()
+
+	m.Set("default", 1)
+	m.SetWithTTL("short", 2, time.Second)
+	m.SetWithTTL("forever", 3, 0)
+	m.SetWithTTL("deleted", 4, time.Second)
+	m.Delete("deleted")
+	m.SetWithTTL("past", 5, time.Minute)
+	m.SetWithTTL("past", 6, -time.Second) //截止时间已经过了，不保存，原来的值也删掉
+
+	if _, ok := m.Get("past"); ok {
+		t.Fatal("value with a negative TTL is visible")
+	}
+
+	if v, ttl, ok := m.GetWithTTL("default"); !ok || v != 1 || ttl != time.Minute {
+		t.Fatalf("GetWithTTL(default) = %v, %v, %v", v, ttl, ok)
+	}
+	if _, ttl, ok := m.GetWithTTL("forever"); !ok || ttl != 0 {
+		t.Fatalf("GetWithTTL(forever) = %v, %v", ttl, ok)
+	}
+
+	clock.Advance(time.Second)
+	if _, ok := m.Get("short"); ok {
+		t.Fatal("expired key is still visible")
+	}
+	if m.Count() != 2 {
+		t.Fatalf("Count = %d, want 2", m.Count())
+	}
+	if n := m.DeleteExpired(); n != 1 || len(evicted) != 1 || evicted[0] != "short" {
+		t.Fatalf("DeleteExpired = %d, evicted %v", n, evicted)
+	}
+
+	clock.Advance(time.Hour)
+	m.DeleteExpired()
+	sort.Strings(evicted)
+	if len(evicted) != 2 || evicted[0] != "default" {
+		t.Fatalf("evicted %v", evicted)
+	}
+	if v, ok := m.Get("forever"); !ok || v != 3 {
+		t.Fatal("key without TTL expired")
+	}
+}
+
+//TestTTLMapJanitor 拨动时钟触发清理 goroutine 删除过期的元素，OnEvict 中可以访问 map；Close 之后所有清理 goroutine 都退出了
+func TestTTLMapJanitor(t *testing.T) {
+	before := runtime.NumGoroutine()
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	evicted := make(chan string, 100)
+	var m *_map.TTLMap
+	m = _map.NewTTLMap(_map.TTLOptions{
+		CleanupInterval: time.Minute,
+		Clock:           clock,
+		OnEvict: func(key string, value interface{}) {
+			m.Set(key+"-evicted", value)
+			evicted <- key
+		},
+	}, _map.WithShardCount(8))
+
+	for _, key := range []string{"a", "b", "c"} {
+		m.SetWithTTL(key, key, time.Second)
+	}
+	clock.Advance(2 * time.Second)
+	select {
+	case key := <-evicted:
+		t.Fatalf("%s evicted before the cleanup interval", key)
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(time.Minute)
+
+	got := make(map[string]bool)
+	for len(got) < 3 {
+		select {
+		case key := <-evicted:
+			got[key] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("janitors evicted only %v", got)
+		}
+	}
+	if !m.Has("a-evicted") || m.Count() != 3 {
+		t.Fatalf("Count = %d after eviction", m.Count())
+	}
+
+	m.Close()
+	m.Close()
+	for i := 0; runtime.NumGoroutine() > before; i++ {
+		if i == 100 {
+			t.Fatalf("%d goroutines before, %d after Close", before, runtime.NumGoroutine())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,161 @@
+package race
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+/**
+  基于 SliceQueue 的有界阻塞队列，用作流水线各个阶段之间的工作队列
+*/
+
+var (
+	//ErrQueueClosed 队列已经关闭（Take 时队列也已经取空）
+	ErrQueueClosed = errors.New("race: queue closed")
+	//ErrQueueFull 队列已满
+	ErrQueueFull = errors.New("race: queue full")
+	//ErrQueueEmpty 队列为空
+	ErrQueueEmpty = errors.New("race: queue empty")
+)
+
+//BlockingQueue 有界阻塞队列，队满时 Put 阻塞，队空时 Take 阻塞
+//slots 和 items 两个 channel 当作信号量使用：slots 是剩余的空位，items 是可以取的元素，
+//这样阻塞的时候可以和 ctx.Done()、closed 一起 select
+type BlockingQueue struct {
+	q     *SliceQueue
+	slots chan struct{}
+	items chan struct{}
+
+	mu     sync.Mutex //Put 入队和 Close 互斥，保证关闭之后不会再有元素入队
+	closed chan struct{}
+}
+
+//NewBlockingQueue 创建容量为 n 的阻塞队列
+func NewBlockingQueue(n int) *BlockingQueue {
+	if n <= 0 {
+		panic("race: BlockingQueue capacity must be positive")
+	}
+	q := &BlockingQueue{
+		q:      NewSliceQueue(n),
+		slots:  make(chan struct{}, n),
+		items:  make(chan struct{}, n),
+		closed: make(chan struct{}),
+	}
+	for i := 0; i < n; i++ {
+		q.slots <- struct{}{}
+	}
+	return q
+}
+
+//Put 入队，队满时阻塞，队列关闭后返回 ErrQueueClosed
+func (q *BlockingQueue) Put(v interface{}) error {
+	return q.PutContext(context.Background(), v)
+}
+
+//PutContext 入队，队满时阻塞直到有空位、ctx 被取消或者队列被关闭
+func (q *BlockingQueue) PutContext(ctx context.Context, v interface{}) error {
+	select {
+	case <-q.slots:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-q.closed:
+		return ErrQueueClosed
+	}
+	return q.put(v)
+}
+
+//TryPut 入队，队满时立即返回 ErrQueueFull
+func (q *BlockingQueue) TryPut(v interface{}) error {
+	select {
+	case <-q.slots:
+	default:
+		select {
+		case <-q.closed:
+			return ErrQueueClosed
+		default:
+			return ErrQueueFull
+		}
+	}
+	return q.put(v)
+}
+
+//put 已经拿到空位，在 mu 的保护下检查是否关闭并入队
+func (q *BlockingQueue) put(v interface{}) error {
+	q.mu.Lock()
+	select {
+	case <-q.closed:
+		q.mu.Unlock()
+		q.slots <- struct{}{}
+		return ErrQueueClosed
+	default:
+	}
+	q.q.Enqueue(v)
+	q.items <- struct{}{} //lockcheck:ignore items 的容量和空位数一样，不会阻塞
+	q.mu.Unlock()
+	return nil
+}
+
+//Take 出队，队空时阻塞，队列关闭并且取空后返回 ErrQueueClosed
+func (q *BlockingQueue) Take() (interface{}, error) {
+	return q.TakeContext(context.Background())
+}
+
+//TakeContext 出队，队空时阻塞直到有元素、ctx 被取消或者队列被关闭
+//关闭之前已经入队的元素仍然可以取出来
+func (q *BlockingQueue) TakeContext(ctx context.Context) (interface{}, error) {
+	select {
+	case <-q.items:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-q.closed:
+		select {
+		case <-q.items:
+		default:
+			return nil, ErrQueueClosed
+		}
+	}
+	return q.take(), nil
+}
+
+//TryTake 出队，队空时立即返回 ErrQueueEmpty，关闭并且取空后返回 ErrQueueClosed
+func (q *BlockingQueue) TryTake() (interface{}, error) {
+	select {
+	case <-q.items:
+	default:
+		select {
+		case <-q.closed:
+			return nil, ErrQueueClosed
+		default:
+			return nil, ErrQueueEmpty
+		}
+	}
+	return q.take(), nil
+}
+
+func (q *BlockingQueue) take() interface{} {
+	v := q.q.Dequeue()
+	q.slots <- struct{}{}
+	return v
+}
+
+//Close 关闭队列，之后 Put 返回 ErrQueueClosed，消费者可以继续取出剩余的元素，重复调用没有影响
+func (q *BlockingQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-q.closed:
+	default:
+		close(q.closed)
+	}
+}
+
+//Len 队列中元素的数量
+func (q *BlockingQueue) Len() int {
+	return q.q.Len()
+}
+
+//Cap 队列的容量
+func (q *BlockingQueue) Cap() int {
+	return cap(q.slots)
+}
@@ -0,0 +1,317 @@
+package race
+
+import (
+	"bytes"
+	"fmt"
+	"go-learn.com/v1/biz/internal/goid"
+	"log"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+  CheckedMutex 检查模式的 Mutex：把 race_bug.go 中的误用变成带调用栈的诊断信息，而不是进程直接 fatal
+*/
+
+//对应 race_bug.go 中的四种错误：
+//1、Lock/Unlock 未成对出现：释放未加锁的 Mutex 会报告 UnlockOfUnlocked，并且不会真正调用 Unlock；
+//   加锁后一直不释放会报告 HeldTooLong，持有锁的 goroutine 退出了会报告 HolderExited
+//2、Copy 已使用的Mutex：报告 Copied
+//3、重入：报告 Reentry，之后按重入处理，避免进程卡死
+//4、死锁：加锁顺序的检测请使用 biz/deadlock
+//持有者检测假设 Lock/Unlock 在同一个 goroutine 中调用，把锁交给其他 goroutine 释放的用法会被误报为 HolderExited
+
+//MisuseKind 误用的类型
+type MisuseKind int
+
+const (
+	//UnlockOfUnlocked 释放未加锁的 Mutex
+	UnlockOfUnlocked MisuseKind = iota
+	//HeldTooLong 持有锁的时间超过 MaxHold
+	HeldTooLong
+	//HolderExited 持有锁的 goroutine 已经退出
+	HolderExited
+	//Reentry 同一个 goroutine 重复加锁
+	Reentry
+	//Copied 使用过的 Mutex 被复制
+	Copied
+)
+
+func (k MisuseKind) String() string {
+	switch k {
+	case UnlockOfUnlocked:
+		return "unlock of unlocked mutex"
+	case HeldTooLong:
+		return "mutex held too long"
+	case HolderExited:
+		return "goroutine exited while holding mutex"
+	case Reentry:
+		return "mutex locked again by its holder"
+	case Copied:
+		return "mutex copied after first use"
+	}
+	return "MisuseKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+//MisuseError 一次误用的诊断信息
+type MisuseError struct {
+	Kind MisuseKind
+	Name string
+
+	//发现问题的 goroutine 和调用位置，后台检查发现的问题（HeldTooLong、HolderExited）没有
+	Goroutine int64
+	Stack     []uintptr
+
+	//持有者和它加锁的位置
+	Holder       int64
+	AcquireStack []uintptr
+	Held         time.Duration
+}
+
+func (e *MisuseError) Error() string {
+	msg := fmt.Sprintf("race: %s %q", e.Kind, e.Name)
+	if e.Holder != 0 {
+		msg += fmt.Sprintf(" (holder goroutine %d, held %v)", e.Holder, e.Held)
+	}
+	return msg
+}
+
+//Stacks 格式化发现问题的位置和加锁的位置
+func (e *MisuseError) Stacks() string {
+	var b strings.Builder
+	if e.Stack != nil {
+		fmt.Fprintf(&b, "goroutine %d:\n", e.Goroutine)
+		writeFrames(&b, e.Stack)
+	}
+	if e.AcquireStack != nil {
+		fmt.Fprintf(&b, "acquired by goroutine %d at:\n", e.Holder)
+		writeFrames(&b, e.AcquireStack)
+	}
+	return b.String()
+}
+
+func writeFrames(b *strings.Builder, pcs []uintptr) {
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(b, "\t%s\n\t\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+}
+
+//CheckInterval 后台检查持有时间和持有者是否退出的间隔
+var CheckInterval = 50 * time.Millisecond
+
+//CheckedMutex 检查模式的 Mutex，零值可用
+type CheckedMutex struct {
+	//Name 出现在诊断信息中
+	Name string
+	//MaxHold 持有锁超过这个时间就报告，0 表示不检查
+	MaxHold time.Duration
+	//OnMisuse 发现误用时的回调，默认用 log 输出
+	OnMisuse func(e *MisuseError)
+
+	mu sync.Mutex
+
+	//下面的字段由 state 保护
+	state        sync.Mutex
+	self         *CheckedMutex //第一次使用时记录自己的地址，用来发现复制
+	holder       int64
+	acquiredAt   time.Time
+	acquireStack []uintptr
+	recursion    int32
+	reportedLong bool
+	reportedExit bool
+}
+
+//Lock 获取锁
+func (m *CheckedMutex) Lock() {
+	gid, stack := goid.Get(), callerStack(1)
+	m.checkCopy(gid, stack)
+
+	m.state.Lock()
+	if m.holder == gid {
+		m.recursion++
+		e := m.misuse(Reentry, gid, stack)
+		m.state.Unlock()
+		m.report(e)
+		return
+	}
+	m.state.Unlock()
+
+	m.mu.Lock()
+
+	m.state.Lock()
+	m.holder, m.acquiredAt, m.acquireStack = gid, time.Now(), stack
+	m.recursion = 1
+	m.reportedLong, m.reportedExit = false, false
+	m.state.Unlock()
+
+	checker.add(m)
+}
+
+//Unlock 释放锁，未加锁时只报告不释放
+func (m *CheckedMutex) Unlock() {
+	gid, stack := goid.Get(), callerStack(1)
+	m.checkCopy(gid, stack)
+
+	m.state.Lock()
+	if m.holder == 0 {
+		e := m.misuse(UnlockOfUnlocked, gid, stack)
+		m.state.Unlock()
+		m.report(e)
+		return
+	}
+	if m.recursion--; m.recursion > 0 {
+		m.state.Unlock()
+		return
+	}
+	m.holder, m.acquireStack = 0, nil
+	m.state.Unlock()
+
+	checker.remove(m)
+	m.mu.Unlock()
+}
+
+func (m *CheckedMutex) checkCopy(gid int64, stack []uintptr) {
+	m.state.Lock()
+	var e *MisuseError
+	if m.self == nil {
+		m.self = m
+	} else if m.self != m {
+		e = m.misuse(Copied, gid, stack)
+		m.self = m //同一个副本只报告一次
+	}
+	m.state.Unlock()
+
+	if e != nil {
+		m.report(e)
+	}
+}
+
+//misuse 需要持有 state
+func (m *CheckedMutex) misuse(kind MisuseKind, gid int64, stack []uintptr) *MisuseError {
+	e := &MisuseError{
+		Kind: kind, Name: m.Name,
+		Goroutine: gid, Stack: stack,
+		Holder: m.holder, AcquireStack: m.acquireStack,
+	}
+	if m.holder != 0 {
+		e.Held = time.Since(m.acquiredAt)
+	}
+	return e
+}
+
+func (m *CheckedMutex) report(e *MisuseError) {
+	if m.OnMisuse != nil {
+		m.OnMisuse(e)
+		return
+	}
+	log.Printf("%v\n%s", e, e.Stacks())
+}
+
+//callerStack 获取调用位置，skip 是需要跳过的调用者层数
+func callerStack(skip int) []uintptr {
+	var pcs [32]uintptr
+	n := runtime.Callers(skip+2, pcs[:])
+	return append([]uintptr(nil), pcs[:n]...)
+}
+
+//checker 后台检查所有被持有的 CheckedMutex，没有被持有的锁时退出
+var checker = &holdChecker{held: make(map[*CheckedMutex]struct{})}
+
+type holdChecker struct {
+	mu      sync.Mutex
+	held    map[*CheckedMutex]struct{}
+	running bool
+}
+
+func (c *holdChecker) add(m *CheckedMutex) {
+	c.mu.Lock()
+	c.held[m] = struct{}{}
+	if !c.running {
+		c.running = true
+		go c.loop()
+	}
+	c.mu.Unlock()
+}
+
+func (c *holdChecker) remove(m *CheckedMutex) {
+	c.mu.Lock()
+	delete(c.held, m)
+	c.mu.Unlock()
+}
+
+func (c *holdChecker) loop() {
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.mu.Lock()
+		if len(c.held) == 0 {
+			c.running = false
+			c.mu.Unlock()
+			return
+		}
+		held := make([]*CheckedMutex, 0, len(c.held))
+		for m := range c.held {
+			held = append(held, m)
+		}
+		c.mu.Unlock()
+
+		snapshot := time.Now()
+		alive := liveGoroutines()
+		for _, m := range held {
+			var reports []*MisuseError
+			m.state.Lock()
+			if m.holder != 0 {
+				//快照之后才加锁的 goroutine 不在 alive 中，不能判断
+				if _, ok := alive[m.holder]; !ok && !m.reportedExit && m.acquiredAt.Before(snapshot) {
+					m.reportedExit = true
+					reports = append(reports, m.misuse(HolderExited, 0, nil))
+				}
+				if m.MaxHold > 0 && time.Since(m.acquiredAt) > m.MaxHold && !m.reportedLong {
+					m.reportedLong = true
+					reports = append(reports, m.misuse(HeldTooLong, 0, nil))
+				}
+			}
+			m.state.Unlock()
+
+			for _, e := range reports {
+				m.report(e)
+			}
+		}
+	}
+}
+
+//liveGoroutines 从 runtime.Stack(all) 中解析出所有存活的 goroutine id
+func liveGoroutines() map[int64]struct{} {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	alive := make(map[int64]struct{})
+	prefix := []byte("goroutine ")
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		if !bytes.HasPrefix(line, prefix) {
+			continue
+		}
+		line = line[len(prefix):]
+		if i := bytes.IndexByte(line, ' '); i > 0 {
+			if id, err := strconv.ParseInt(string(line[:i]), 10, 64); err == nil {
+				alive[id] = struct{}{}
+			}
+		}
+	}
+	return alive
+}
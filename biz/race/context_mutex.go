@@ -0,0 +1,76 @@
+package race
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+/**
+  TokenRecursiveMutex 的 context 版本：token 放在 context 里跟着请求走
+*/
+
+//TokenRecursiveMutex 需要调用者自己传 int64 的 token，很容易传错，也不满足 Locker 接口。
+//这里把 token 放到 context.Context 中，同一个逻辑请求（同一个 token）可以重入，
+//即使工作通过 biz/channel 里那样的 channel 流水线交给了另一个 goroutine，只要 ctx 一起传过去就算同一个持有者。
+//注意：同一个 token 的多次加锁需要像函数调用一样嵌套，不能在外层 Unlock 之后内层还在使用。
+
+type lockTokenKey struct{}
+
+//最后一次分配的 token，0 表示未持有，所以从 1 开始
+var lastLockToken int64
+
+//WithLockToken 给 ctx 分配一个 token，ctx 中已经有 token 时直接返回 ctx，保证同一个请求只有一个 token
+func WithLockToken(ctx context.Context) context.Context {
+	if _, ok := LockToken(ctx); ok {
+		return ctx
+	}
+	return NewLockToken(ctx)
+}
+
+//NewLockToken 总是分配一个新的 token，用来开始一个新的逻辑请求，它不会和 ctx 中原来的 token 重入
+func NewLockToken(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lockTokenKey{}, atomic.AddInt64(&lastLockToken, 1))
+}
+
+//LockToken 获取 ctx 中的 token
+func LockToken(ctx context.Context) (int64, bool) {
+	token, ok := ctx.Value(lockTokenKey{}).(int64)
+	return token, ok
+}
+
+//ContextRecursiveMutex 通过 ctx 中的 token 识别持有者的可重入锁，零值可用
+type ContextRecursiveMutex struct {
+	m TokenRecursiveMutex
+}
+
+//Lock 获取锁，ctx 中没有 token 会 panic
+func (m *ContextRecursiveMutex) Lock(ctx context.Context) {
+	m.m.Lock(mustLockToken(ctx))
+}
+
+//Unlock 释放锁，ctx 中的 token 必须和持有者一致
+func (m *ContextRecursiveMutex) Unlock(ctx context.Context) {
+	m.m.Unlock(mustLockToken(ctx))
+}
+
+//Locker 返回绑定了 ctx 的 sync.Locker，可以传给只接受 Locker 的代码，比如 sync.NewCond
+func (m *ContextRecursiveMutex) Locker(ctx context.Context) sync.Locker {
+	return &contextLocker{m: m, token: mustLockToken(ctx)}
+}
+
+type contextLocker struct {
+	m     *ContextRecursiveMutex
+	token int64
+}
+
+func (l *contextLocker) Lock()   { l.m.m.Lock(l.token) }
+func (l *contextLocker) Unlock() { l.m.m.Unlock(l.token) }
+
+func mustLockToken(ctx context.Context) int64 {
+	token, ok := LockToken(ctx)
+	if !ok {
+		panic("race: no lock token in context, use WithLockToken")
+	}
+	return token
+}
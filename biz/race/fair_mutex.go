@@ -0,0 +1,99 @@
+package race
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+/**
+  公平的 FIFO 互斥锁：严格按照请求的先后顺序获取锁
+*/
+
+//sync.Mutex 在正常模式下，新来的 goroutine 和被唤醒的 goroutine 一起抢锁，新来的往往更容易抢到，
+//只有某个等待者等待超过 1ms 才会进入饥饿模式变得公平。对延迟敏感的路径可以使用 FairMutex：
+//等待者按顺序排成队列，Unlock 时直接把锁交给队头的等待者，后来的 goroutine 不能插队。
+//代价是每次交接都要唤醒一个 goroutine，竞争激烈时吞吐量比 Mutex 低，尾延迟更稳定，见 race_test.go 中的 BenchmarkMutexContention。
+
+//FairMutex 公平的互斥锁，零值可用
+type FairMutex struct {
+	mu      sync.Mutex
+	locked  bool
+	waiters list.List //*fairWaiter，按请求的顺序排列
+}
+
+type fairWaiter struct {
+	ready   chan struct{} //拿到锁时关闭
+	granted bool          //已经把锁交给了这个等待者，由 FairMutex.mu 保护
+}
+
+//Lock 获取锁
+func (m *FairMutex) Lock() {
+	m.LockContext(context.Background())
+}
+
+//TryLock 尝试获取锁，锁被持有或者有人在排队时立即返回false
+func (m *FairMutex) TryLock() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locked || m.waiters.Len() > 0 {
+		return false
+	}
+	m.locked = true
+	return true
+}
+
+//LockTimeout 在d时间内获取锁，超时返回false
+func (m *FairMutex) LockTimeout(d time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	return m.LockContext(ctx) == nil
+}
+
+//LockContext 排队获取锁，ctx 被取消时离开队列并返回 ctx.Err()
+func (m *FairMutex) LockContext(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.locked && m.waiters.Len() == 0 {
+		m.locked = true
+		m.mu.Unlock()
+		return nil
+	}
+	w := &fairWaiter{ready: make(chan struct{})}
+	e := m.waiters.PushBack(w)
+	m.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	//取消的同时锁已经交了过来，就当作获取成功
+	if w.granted {
+		return nil
+	}
+	m.waiters.Remove(e)
+	return ctx.Err()
+}
+
+//Unlock 释放锁，有等待者时直接交给队头的等待者
+func (m *FairMutex) Unlock() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.locked {
+		panic("race: unlock of unlocked FairMutex")
+	}
+
+	e := m.waiters.Front()
+	if e == nil {
+		m.locked = false
+		return
+	}
+	w := m.waiters.Remove(e).(*fairWaiter)
+	w.granted = true //locked 保持为 true，所有权直接转移
+	close(w.ready)
+}
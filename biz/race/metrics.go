@@ -0,0 +1,117 @@
+package race
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/**
+  Mutex 状态导出：把命名的 Mutex 的 state 快照按 Prometheus 文本格式输出，用来观察线上锁竞争
+*/
+
+//MutexRegistry 命名 Mutex 的注册表，可以直接作为 http.Handler 挂到 /metrics 上
+type MutexRegistry struct {
+	mu      sync.RWMutex
+	mutexes map[string]*Mutex
+}
+
+//NewMutexRegistry 创建一个注册表
+func NewMutexRegistry() *MutexRegistry {
+	return &MutexRegistry{mutexes: make(map[string]*Mutex)}
+}
+
+//Register 以name注册一个Mutex，同名的会被覆盖
+func (r *MutexRegistry) Register(name string, m *Mutex) {
+	r.mu.Lock()
+	r.mutexes[name] = m
+	r.mu.Unlock()
+}
+
+//Unregister 移除name对应的Mutex
+func (r *MutexRegistry) Unregister(name string) {
+	r.mu.Lock()
+	delete(r.mutexes, name)
+	r.mu.Unlock()
+}
+
+//Snapshot 获取所有已注册 Mutex 当前的状态
+func (r *MutexRegistry) Snapshot() map[string]MutexState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	states := make(map[string]MutexState, len(r.mutexes))
+	for name, m := range r.mutexes {
+		states[name] = m.State()
+	}
+	return states
+}
+
+//WriteTo 以 Prometheus 文本格式输出所有 Mutex 的状态
+func (r *MutexRegistry) WriteTo(w io.Writer) (int64, error) {
+	states := r.Snapshot()
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metrics := []struct {
+		name  string
+		help  string
+		value func(s MutexState) int
+	}{
+		{"go_mutex_locked", "Whether the mutex is held (1) or not (0).", func(s MutexState) int { return b2i(s.Locked) }},
+		{"go_mutex_woken", "Whether a woken goroutine is competing for the mutex.", func(s MutexState) int { return b2i(s.Woken) }},
+		{"go_mutex_starving", "Whether the mutex is in starvation mode.", func(s MutexState) int { return b2i(s.Starving) }},
+		{"go_mutex_waiters", "Number of goroutines waiting for the mutex.", func(s MutexState) int { return s.Waiters }},
+	}
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, metric := range metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", metric.name)
+		for _, name := range names {
+			fmt.Fprintf(bw, "%s{name=\"%s\"} %d\n", metric.name, escapeLabel(name), metric.value(states[name]))
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+//ServeHTTP 实现 http.Handler
+func (r *MutexRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+//label 的值需要转义反斜杠、双引号和换行
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+//统计写入的字节数
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -2,7 +2,7 @@ package race
 
 import (
 	"fmt"
-	"github.com/petermattis/goid"
+	"go-learn.com/v1/biz/internal/goid"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -65,7 +65,9 @@ func reentryMain()  {
 }
 
 //实现可重入锁！！！！！！！！！！！！！！
-//方法1: 通过hacker的方式获取到 goroutine id 记录下获取锁的goroutine id,它可以实现Locker接口
+//方法1: 获取到 goroutine id 记录下获取锁的goroutine id,它可以实现Locker接口
+//goroutine id 由 biz/internal/goid 从 runtime.Stack 的第一行 "goroutine 18 [running]:" 解析，不读取 runtime 内部的 g 结构，只依赖这行公开的输出格式，
+//所以升级 Go 版本不会悄悄拿到错误的 id；代价是每次 Lock、Unlock 多花一到几微秒
 //example：
 type RecursiveMutex struct {
 	sync.Mutex
@@ -77,27 +79,25 @@ func (m *RecursiveMutex) Lock() {
 	gid := goid.Get()
 	//如果当前持有锁的goroutine 就是调用这次调用的goroutine，说明就是重入
 	if atomic.LoadInt64(&m.owner) == gid {
-		m.recursion++
+		atomic.AddInt32(&m.recursion, 1)
 		return
 	}
 
 	m.Mutex.Lock()
 	// 获取锁的goroutine第一次调用，记录下 gid 并记录调用次数
 	atomic.StoreInt64(&m.owner, gid)
-	m.recursion = 1
+	atomic.StoreInt32(&m.recursion, 1)
 }
 
 func (m *RecursiveMutex) Unlock() {
 	gid := goid.Get()
 	// 非持有锁的goroutine尝试释放锁，错误的使用
-	if atomic.LoadInt64(&m.owner) != gid {
-		panic(fmt.Sprintf("wrong thr owner(%d): %d!", m.owner, gid))
+	if owner := atomic.LoadInt64(&m.owner); owner != gid {
+		panic(fmt.Sprintf("wrong thr owner(%d): %d!", owner, gid))
 	}
 
-	//调用次数减1
-	m.recursion--
-	//如果goroutine还没有完全释放，直接返回
-	if m.recursion != 0 {
+	//调用次数减1，如果goroutine还没有完全释放，直接返回
+	if atomic.AddInt32(&m.recursion, -1) != 0 {
 		return
 	}
 
@@ -118,7 +118,7 @@ type TokenRecursiveMutex struct {
 func (m *TokenRecursiveMutex) Lock(token int64) {
 	//如果token 一致，说明就是重入
 	if atomic.LoadInt64(&m.token) == token {
-		m.recursion++
+		atomic.AddInt32(&m.recursion, 1)
 		return
 	}
 
@@ -126,19 +126,17 @@ func (m *TokenRecursiveMutex) Lock(token int64) {
 	m.Mutex.Lock()
 	// 获取锁后记录token
 	atomic.StoreInt64(&m.token, token)
-	m.recursion = 1
+	atomic.StoreInt32(&m.recursion, 1)
 }
 
 func (m *TokenRecursiveMutex) Unlock(token int64) {
 	// 释放其他token持有的锁，错误的使用
-	if atomic.LoadInt64(&m.token) != token {
-		panic(fmt.Sprintf("wrong thr owner(%d): %d!", m.token, token))
+	if owner := atomic.LoadInt64(&m.token); owner != token {
+		panic(fmt.Sprintf("wrong thr owner(%d): %d!", owner, token))
 	}
 
-	//调用次数减1
-	m.recursion--
-	//如果goroutine还没有完全释放，直接返回
-	if m.recursion != 0 {
+	//调用次数减1，如果goroutine还没有完全释放，直接返回
+	if atomic.AddInt32(&m.recursion, -1) != 0 {
 		return
 	}
 
@@ -1,8 +1,16 @@
 package race_test
 
 import (
+	"bytes"
+	"context"
 	"go-learn.com/v1/biz/race"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 //TestRace 互斥锁的使用
@@ -15,6 +23,634 @@ func TestRaceStruct(t *testing.T)  {
 	race.RaceStruct()
 }
 
+//TestMutexTryLock 锁被持有时 TryLock 立即失败，释放后可以获取
+func TestMutexTryLock(t *testing.T) {
+	var mu race.Mutex
+	if !mu.TryLock() {
+		t.Fatal("TryLock on unlocked mutex failed")
+	}
+	if mu.TryLock() {
+		t.Fatal("TryLock on locked mutex succeeded")
+	}
+	mu.Unlock()
+	if !mu.TryLock() {
+		t.Fatal("TryLock after Unlock failed")
+	}
+	mu.Unlock()
+}
+
+//TestMutexLockTimeout 超时返回false，持有者释放后可以获取
+func TestMutexLockTimeout(t *testing.T) {
+	var mu race.Mutex
+	mu.Lock()
+
+	start := time.Now()
+	if mu.LockTimeout(20 * time.Millisecond) {
+		t.Fatal("LockTimeout succeeded while mutex is held")
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Fatalf("LockTimeout returned after %v, want >= 20ms", d)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		mu.Unlock()
+	}()
+	if !mu.LockTimeout(time.Second) {
+		t.Fatal("LockTimeout failed after holder released")
+	}
+	mu.Unlock()
+}
+
+//TestMutexLockContext ctx 取消后返回 ctx.Err()
+func TestMutexLockContext(t *testing.T) {
+	var mu race.Mutex
+	mu.Lock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- mu.LockContext(ctx)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("LockContext = %v, want %v", err, context.Canceled)
+	}
+
+	mu.Unlock()
+	if err := mu.LockContext(context.Background()); err != nil {
+		t.Fatalf("LockContext on unlocked mutex = %v", err)
+	}
+	mu.Unlock()
+}
+
+//TestMutexState 解析 state 字段中的持有者和等待者
+func TestMutexState(t *testing.T) {
+	var mu race.Mutex
+	if s := mu.State(); s != (race.MutexState{}) {
+		t.Fatalf("State of unlocked mutex = %+v", s)
+	}
+
+	mu.Lock()
+	const waiters = 3
+	for i := 0; i < waiters; i++ {
+		go func() {
+			mu.Lock()
+			mu.Unlock()
+		}()
+	}
+	waitFor(t, func() bool { return mu.State().Waiters == waiters })
+
+	s := mu.State()
+	if !s.Locked {
+		t.Fatalf("State = %+v, want Locked", s)
+	}
+	if n := mu.Count(); n != waiters+1 {
+		t.Fatalf("Count = %d, want %d", n, waiters+1)
+	}
+	mu.Unlock()
+	waitFor(t, func() bool { return mu.Count() == 0 })
+}
+
+//TestMutexRegistry 按 Prometheus 文本格式输出
+func TestMutexRegistry(t *testing.T) {
+	var a, b race.Mutex
+	r := race.NewMutexRegistry()
+	r.Register("a", &a)
+	r.Register(`b"1`, &b)
+	a.Lock()
+	defer a.Unlock()
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("WriteTo = %d, %v; wrote %d bytes", n, err, buf.Len())
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE go_mutex_locked gauge\n",
+		"go_mutex_locked{name=\"a\"} 1\n",
+		"go_mutex_locked{name=\"b\\\"1\"} 0\n",
+		"go_mutex_waiters{name=\"a\"} 0\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	r.Unregister("a")
+	if _, ok := r.Snapshot()["a"]; ok {
+		t.Fatal("Snapshot still contains unregistered mutex")
+	}
+}
+
+//waitFor 等待条件成立，最多等待1秒
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 1s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+//TestRecursiveMutex 嵌套的 Lock/Unlock
+func TestRecursiveMutex(t *testing.T) {
+	var mu race.RecursiveMutex
+	count := 0
+
+	var nested func(depth int)
+	nested = func(depth int) {
+		mu.Lock()
+		defer mu.Unlock()
+		if depth > 0 {
+			nested(depth - 1)
+			return
+		}
+		count++
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				nested(3)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count != 800 {
+		t.Fatalf("count = %d, want 800", count)
+	}
+}
+
+//TestRecursiveMutexWrongOwner 非持有者释放锁会panic
+func TestRecursiveMutexWrongOwner(t *testing.T) {
+	var mu race.RecursiveMutex
+	mu.Lock()
+	if !panicsInOtherGoroutine(mu.Unlock) {
+		t.Fatal("Unlock by another goroutine did not panic")
+	}
+	mu.Unlock()
+
+	var rw race.RecursiveRWMutex
+	rw.Lock()
+	if !panicsInOtherGoroutine(rw.Unlock) {
+		t.Fatal("RecursiveRWMutex.Unlock by another goroutine did not panic")
+	}
+	rw.Unlock()
+
+	rw.RLock()
+	if !panicsInOtherGoroutine(rw.RUnlock) {
+		t.Fatal("RUnlock by another goroutine did not panic")
+	}
+	rw.RUnlock()
+}
+
+//TestRecursiveRWMutex 持有写锁的goroutine可以再次获取读锁和写锁
+func TestRecursiveRWMutex(t *testing.T) {
+	var rw race.RecursiveRWMutex
+	rw.Lock()
+	rw.RLock()
+	rw.Lock()
+	rw.Unlock()
+	rw.RUnlock()
+	rw.Unlock()
+
+	//释放后其他goroutine可以获取写锁
+	done := make(chan struct{})
+	go func() {
+		rw.Lock()
+		rw.Unlock()
+		close(done)
+	}()
+	<-done
+}
+
+//TestRecursiveRWMutexReaders readersWriters.factorial 的场景：writer等待时同一个goroutine再次RLock不会死锁
+func TestRecursiveRWMutexReaders(t *testing.T) {
+	var rw race.RecursiveRWMutex
+	rw.RLock()
+
+	locked := make(chan struct{})
+	go func() {
+		rw.Lock()
+		close(locked)
+		rw.Unlock()
+	}()
+	time.Sleep(10 * time.Millisecond) //writer 开始等待
+
+	reentered := make(chan struct{})
+	go func() {
+		defer close(reentered)
+		rw.RLock() //另一个goroutine会被等待中的writer阻塞
+		rw.RUnlock()
+	}()
+	rw.RLock() //同一个goroutine重入不会被阻塞
+	rw.RUnlock()
+
+	select {
+	case <-locked:
+		t.Fatal("writer acquired the lock while a reader holds it")
+	default:
+	}
+	rw.RUnlock()
+	<-locked
+	<-reentered
+
+	//持有读锁时不能升级为写锁
+	rw.RLock()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Lock while holding RLock did not panic")
+			}
+		}()
+		rw.Lock()
+	}()
+	rw.RUnlock()
+}
+
+//TestContextRecursiveMutex token 跟着 ctx 通过 channel 交给另一个 goroutine，仍然可以重入
+func TestContextRecursiveMutex(t *testing.T) {
+	var mu race.ContextRecursiveMutex
+	ctx := race.WithLockToken(context.Background())
+	if race.WithLockToken(ctx) != ctx {
+		t.Fatal("WithLockToken minted a second token")
+	}
+
+	work := make(chan context.Context)
+	done := make(chan struct{})
+	go func() {
+		for ctx := range work {
+			l := mu.Locker(ctx)
+			l.Lock() //同一个逻辑请求，重入
+			l.Unlock()
+			done <- struct{}{}
+		}
+	}()
+
+	mu.Lock(ctx)
+	work <- ctx
+	<-done
+
+	//其他请求拿不到锁
+	other := race.NewLockToken(ctx)
+	acquired := make(chan struct{})
+	go func() {
+		mu.Lock(other)
+		close(acquired)
+		mu.Unlock(other)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("another token acquired a held lock")
+	case <-time.After(10 * time.Millisecond):
+	}
+	if !panicsInOtherGoroutine(func() { mu.Unlock(race.NewLockToken(context.Background())) }) {
+		t.Fatal("Unlock with a foreign token did not panic")
+	}
+
+	mu.Unlock(ctx)
+	<-acquired
+	close(work)
+
+	if !panicsInOtherGoroutine(func() { mu.Lock(context.Background()) }) {
+		t.Fatal("Lock without token did not panic")
+	}
+}
+
+//misuses 收集 CheckedMutex 的诊断信息
+type misuses struct {
+	mu     sync.Mutex
+	errors []*race.MisuseError
+}
+
+func (c *misuses) add(e *race.MisuseError) {
+	c.mu.Lock()
+	c.errors = append(c.errors, e)
+	c.mu.Unlock()
+}
+
+//wait 等待出现 kind 类型的诊断信息
+func (c *misuses) wait(t *testing.T, kind race.MisuseKind) *race.MisuseError {
+	t.Helper()
+	var found *race.MisuseError
+	waitFor(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, e := range c.errors {
+			if e.Kind == kind {
+				found = e
+				return true
+			}
+		}
+		return false
+	})
+	return found
+}
+
+//TestCheckedMutexUnlockOfUnlocked 释放未加锁的Mutex只报告，不会fatal
+func TestCheckedMutexUnlockOfUnlocked(t *testing.T) {
+	var c misuses
+	mu := &race.CheckedMutex{Name: "foo", OnMisuse: c.add}
+	mu.Unlock()
+
+	e := c.wait(t, race.UnlockOfUnlocked)
+	if !strings.Contains(e.Stacks(), "TestCheckedMutexUnlockOfUnlocked") {
+		t.Fatalf("stack does not point at the caller:\n%s", e.Stacks())
+	}
+	if e.Error() != `race: unlock of unlocked mutex "foo"` {
+		t.Fatalf("Error() = %q", e.Error())
+	}
+
+	//之后仍然可以正常使用
+	mu.Lock()
+	mu.Unlock()
+}
+
+//TestCheckedMutexHeld 持有时间过长，以及持有锁的goroutine退出
+func TestCheckedMutexHeld(t *testing.T) {
+	var c misuses
+	mu := &race.CheckedMutex{Name: "leak", MaxHold: 10 * time.Millisecond, OnMisuse: c.add}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mu.Lock() //忘记 Unlock
+	}()
+	<-done
+
+	for _, kind := range []race.MisuseKind{race.HolderExited, race.HeldTooLong} {
+		e := c.wait(t, kind)
+		if e.Holder == 0 || !strings.Contains(e.Stacks(), "TestCheckedMutexHeld") {
+			t.Fatalf("%v: missing acquiring stack:\n%s", kind, e.Stacks())
+		}
+	}
+	mu.Unlock()
+}
+
+//TestCheckedMutexReentry 重入只报告，不会卡死
+func TestCheckedMutexReentry(t *testing.T) {
+	var c misuses
+	mu := &race.CheckedMutex{OnMisuse: c.add}
+	mu.Lock()
+	mu.Lock()
+	mu.Unlock()
+	mu.Unlock()
+
+	e := c.wait(t, race.Reentry)
+	if e.Goroutine != e.Holder {
+		t.Fatalf("Reentry by goroutine %d, holder %d", e.Goroutine, e.Holder)
+	}
+	done := make(chan struct{})
+	go func() {
+		mu.Lock()
+		mu.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("mutex still held after paired Unlock")
+	}
+}
+
+//TestCheckedMutexCopied 复制使用过的Mutex
+func TestCheckedMutexCopied(t *testing.T) {
+	var c misuses
+	mu := &race.CheckedMutex{OnMisuse: c.add}
+	mu.Lock()
+	mu.Unlock()
+
+	//用反射复制，绕过 go vet 的 copylocks 检查
+	var copied race.CheckedMutex
+	reflect.ValueOf(&copied).Elem().Set(reflect.ValueOf(mu).Elem())
+	copied.Lock()
+	copied.Unlock()
+
+	c.wait(t, race.Copied)
+}
+
+//TestSliceQueue 先进先出，出队后回收空间
+func TestSliceQueue(t *testing.T) {
+	q := race.NewSliceQueue(4)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 100; i++ {
+			q.Enqueue(i)
+		}
+		for i := 0; i < 100; i++ {
+			if v := q.Dequeue(); v != i {
+				t.Fatalf("Dequeue = %v, want %d", v, i)
+			}
+			if n := q.Len(); n != 99-i {
+				t.Fatalf("Len = %d, want %d", n, 99-i)
+			}
+		}
+		if v := q.Dequeue(); v != nil {
+			t.Fatalf("Dequeue on empty queue = %v", v)
+		}
+	}
+}
+
+//TestBlockingQueue 队满时 Put 阻塞，Take 之后继续
+func TestBlockingQueue(t *testing.T) {
+	q := race.NewBlockingQueue(2)
+	if err := q.Put(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.TryPut(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.TryPut(3); err != race.ErrQueueFull {
+		t.Fatalf("TryPut on full queue = %v", err)
+	}
+
+	put := make(chan error)
+	go func() { put <- q.Put(3) }()
+	select {
+	case <-put:
+		t.Fatal("Put did not block on full queue")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	for want := 1; want <= 3; want++ {
+		v, err := q.Take()
+		if err != nil || v != want {
+			t.Fatalf("Take = %v, %v; want %d", v, err, want)
+		}
+		if want == 1 {
+			if err := <-put; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := q.TryTake(); err != race.ErrQueueEmpty {
+		t.Fatalf("TryTake on empty queue = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.TakeContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("TakeContext = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+//TestBlockingQueueClose 关闭后 Put 失败，消费者取完剩余元素后得到 ErrQueueClosed
+func TestBlockingQueueClose(t *testing.T) {
+	q := race.NewBlockingQueue(100)
+	const producers, items = 4, 1000
+
+	var sum int64
+	var consumers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				v, err := q.Take()
+				if err == race.ErrQueueClosed {
+					return
+				}
+				atomic.AddInt64(&sum, int64(v.(int)))
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < producers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 1; j <= items; j++ {
+				if err := q.Put(j); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	q.Close()
+	q.Close()
+	consumers.Wait()
+
+	if want := int64(producers * items * (items + 1) / 2); sum != want {
+		t.Fatalf("sum = %d, want %d", sum, want)
+	}
+	if err := q.Put(1); err != race.ErrQueueClosed {
+		t.Fatalf("Put after Close = %v", err)
+	}
+	if _, err := q.TryTake(); err != race.ErrQueueClosed {
+		t.Fatalf("TryTake after Close = %v", err)
+	}
+}
+
+//TestFairMutexFIFO 等待者按到达的顺序获取锁
+func TestFairMutexFIFO(t *testing.T) {
+	var mu race.FairMutex
+	mu.Lock()
+	if mu.TryLock() {
+		t.Fatal("TryLock on locked FairMutex succeeded")
+	}
+
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+		}(i)
+		time.Sleep(5 * time.Millisecond) //保证按顺序排队
+	}
+	mu.Unlock()
+	wg.Wait()
+
+	for i, v := range order {
+		if v != i {
+			t.Fatalf("order = %v, want FIFO", order)
+		}
+	}
+}
+
+//TestFairMutexLockTimeout 超时的等待者离开队列，不影响后面的等待者
+func TestFairMutexLockTimeout(t *testing.T) {
+	var mu race.FairMutex
+	mu.Lock()
+	if mu.LockTimeout(10 * time.Millisecond) {
+		t.Fatal("LockTimeout succeeded while mutex is held")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		mu.Lock()
+		close(done)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	mu.Unlock()
+	<-done
+	mu.Unlock()
+
+	if !mu.TryLock() {
+		t.Fatal("TryLock on unlocked FairMutex failed")
+	}
+	mu.Unlock()
+}
+
+//BenchmarkMutexContention 比较 Mutex 和 FairMutex 在竞争下的吞吐量和等锁的尾延迟
+func BenchmarkMutexContention(b *testing.B) {
+	b.Run("Mutex", func(b *testing.B) { benchmarkLocker(b, &race.Mutex{}) })
+	b.Run("FairMutex", func(b *testing.B) { benchmarkLocker(b, &race.FairMutex{}) })
+}
+
+func benchmarkLocker(b *testing.B, l sync.Locker) {
+	var mu sync.Mutex
+	var waits []time.Duration
+
+	b.RunParallel(func(pb *testing.PB) {
+		local := make([]time.Duration, 0, 1024)
+		for pb.Next() {
+			start := time.Now()
+			l.Lock()
+			local = append(local, time.Since(start))
+			l.Unlock()
+		}
+		mu.Lock()
+		waits = append(waits, local...)
+		mu.Unlock()
+	})
+
+	if len(waits) == 0 {
+		return
+	}
+	sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+	b.ReportMetric(float64(waits[len(waits)/2]), "p50-wait-ns")
+	b.ReportMetric(float64(waits[len(waits)*99/100]), "p99-wait-ns")
+	b.ReportMetric(float64(waits[len(waits)-1]), "max-wait-ns")
+}
+
+//panicsInOtherGoroutine 在另一个goroutine中执行f，返回是否panic
+func panicsInOtherGoroutine(f func()) bool {
+	panicked := make(chan bool)
+	go func() {
+		defer func() {
+			panicked <- recover() != nil
+		}()
+		f()
+	}()
+	return <-panicked
+}
+
 //问题
 // 1. 目前Mutex的state字段有几个意义，这几个意义分别是由那些字段表示的
 // 2. 等待一个Mutex 的 goroutine数最大是多少？能否满足现实的需求
\ No newline at end of file
@@ -0,0 +1,130 @@
+package race
+
+import (
+	"fmt"
+	"go-learn.com/v1/biz/internal/goid"
+	"sync"
+	"sync/atomic"
+)
+
+/**
+  可重入的读写锁：持有写锁的goroutine可以再次获取写锁和读锁，持有读锁的goroutine可以再次获取读锁
+*/
+
+//readersWriters.factorial 的例子里，同一个goroutine递归调用RLock，
+//中间只要有一个writer在等待，第二次RLock就会被阻塞，造成死锁。
+//这里按goroutine记录读锁的重入次数，只有第一次RLock和最后一次RUnlock才会真正操作RWMutex。
+
+//RecursiveRWMutex 可重入的读写锁，零值可用
+type RecursiveRWMutex struct {
+	rw sync.RWMutex
+
+	owner       int64 //当前持有写锁的goroutine id
+	recursion   int32 //写锁重入次数，只有owner会修改
+	writerReads int32 //owner在持有写锁期间获取的读锁次数，只有owner会修改
+
+	mu      sync.Mutex
+	readers map[int64]int32 //每个goroutine持有读锁的次数
+}
+
+//Lock 获取写锁，持有写锁的goroutine可以重入
+//持有读锁的goroutine不能升级为写锁，否则会一直等待自己释放读锁，这里直接panic
+func (m *RecursiveRWMutex) Lock() {
+	gid := goid.Get()
+	if atomic.LoadInt64(&m.owner) == gid {
+		atomic.AddInt32(&m.recursion, 1)
+		return
+	}
+	if m.readCount(gid) > 0 {
+		panic(fmt.Sprintf("goroutine %d: Lock while holding RLock", gid))
+	}
+
+	m.rw.Lock()
+	atomic.StoreInt64(&m.owner, gid)
+	atomic.StoreInt32(&m.recursion, 1)
+}
+
+//Unlock 释放写锁，只能由持有者释放
+func (m *RecursiveRWMutex) Unlock() {
+	gid := goid.Get()
+	if owner := atomic.LoadInt64(&m.owner); owner != gid {
+		panic(fmt.Sprintf("wrong thr owner(%d): %d!", owner, gid))
+	}
+	if atomic.LoadInt32(&m.recursion) == 1 && atomic.LoadInt32(&m.writerReads) != 0 {
+		panic(fmt.Sprintf("goroutine %d: Unlock while holding RLock", gid))
+	}
+
+	if atomic.AddInt32(&m.recursion, -1) != 0 {
+		return
+	}
+	atomic.StoreInt64(&m.owner, -1)
+	m.rw.Unlock()
+}
+
+//RLock 获取读锁，持有写锁或者读锁的goroutine可以重入
+func (m *RecursiveRWMutex) RLock() {
+	gid := goid.Get()
+	if atomic.LoadInt64(&m.owner) == gid {
+		atomic.AddInt32(&m.writerReads, 1)
+		return
+	}
+
+	//已经持有读锁，只增加次数，不再调用RWMutex.RLock，避免被等待中的writer阻塞
+	m.mu.Lock()
+	if n := m.readers[gid]; n > 0 {
+		m.readers[gid] = n + 1
+		m.mu.Unlock()
+		return
+	}
+	m.mu.Unlock()
+
+	m.rw.RLock()
+
+	m.mu.Lock()
+	if m.readers == nil {
+		m.readers = make(map[int64]int32)
+	}
+	m.readers[gid] = 1
+	m.mu.Unlock()
+}
+
+//RUnlock 释放读锁，只能由持有者释放
+func (m *RecursiveRWMutex) RUnlock() {
+	gid := goid.Get()
+	if atomic.LoadInt64(&m.owner) == gid && atomic.LoadInt32(&m.writerReads) > 0 {
+		atomic.AddInt32(&m.writerReads, -1)
+		return
+	}
+
+	m.mu.Lock()
+	n := m.readers[gid]
+	if n == 0 {
+		m.mu.Unlock()
+		panic(fmt.Sprintf("goroutine %d: RUnlock without RLock", gid))
+	}
+	if n > 1 {
+		m.readers[gid] = n - 1
+		m.mu.Unlock()
+		return
+	}
+	delete(m.readers, gid)
+	m.mu.Unlock()
+
+	m.rw.RUnlock()
+}
+
+//RLocker 返回一个使用读锁的 sync.Locker
+func (m *RecursiveRWMutex) RLocker() sync.Locker {
+	return (*recursiveRLocker)(m)
+}
+
+type recursiveRLocker RecursiveRWMutex
+
+func (r *recursiveRLocker) Lock()   { (*RecursiveRWMutex)(r).RLock() }
+func (r *recursiveRLocker) Unlock() { (*RecursiveRWMutex)(r).RUnlock() }
+
+func (m *RecursiveRWMutex) readCount(gid int64) int32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.readers[gid]
+}
@@ -1,6 +1,7 @@
 package race
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"sync"
@@ -24,7 +25,8 @@ type Mutex struct {
 	sync.Mutex
 }
 
-func (m *Mutex) tryLock() bool {
+//TryLock 尝试获取锁，获取不到立即返回false，不会阻塞
+func (m *Mutex) TryLock() bool {
 	//如果能成功抢到锁
 	if atomic.CompareAndSwapInt32((*int32)(unsafe.Pointer(&m.Mutex)), 0, mutexLocked){
 		return true
@@ -52,7 +54,7 @@ func Try()  {
 
 	time.Sleep(time.Second)
 
-	ok := mu.tryLock() //尝试获取锁
+	ok := mu.TryLock() //尝试获取锁
 	if ok {
 		fmt.Println("got the lock")
 
@@ -66,15 +68,74 @@ func Try()  {
 	fmt.Println("cannot get the lock")
 }
 
-//获取state这个字段并进行解析
-func (m *Mutex) Count() int {
+//抢锁失败后的最长退避时间
+const maxLockBackoff = time.Millisecond
+
+//LockTimeout 在d时间内尝试获取锁，超时返回false
+func (m *Mutex) LockTimeout(d time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	return m.LockContext(ctx) == nil
+}
+
+//LockContext 获取锁，直到成功或者ctx被取消，被取消时返回ctx.Err()
+//请求处理时可以借助ctx的deadline快速失败，而不是一直排队等待一个卡住的持有者
+func (m *Mutex) LockContext(ctx context.Context) error {
+	if m.TryLock() {
+		return nil
+	}
+
+	//轮询加退避：每次失败后等待时间翻倍，最长 maxLockBackoff
+	backoff := time.Microsecond
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if m.TryLock() {
+			return nil
+		}
+
+		if backoff < maxLockBackoff {
+			backoff <<= 1
+		}
+		timer.Reset(backoff)
+	}
+}
+
+//MutexState state字段解析后的快照
+type MutexState struct {
+	Locked   bool //是否被持有
+	Woken    bool //是否有被唤醒的goroutine正在抢锁
+	Starving bool //是否处于饥饿模式
+	Waiters  int  //等待者的数量
+}
+
+//State 获取state这个字段并进行解析
+func (m *Mutex) State() MutexState {
 	//获取state字段的值
 	v := atomic.LoadInt32((*int32)(unsafe.Pointer(&m.Mutex)))
 
-	v = v >> mutexWaiterShift //得到等待者的数值
-	v = v >> v + (v & mutexLocked) //在加上锁持有者的数量 0 || 1
+	return MutexState{
+		Locked:   v&mutexLocked != 0,
+		Woken:    v&mutexWoken != 0,
+		Starving: v&mutexStarving != 0,
+		Waiters:  int(v >> mutexWaiterShift), //得到等待者的数值
+	}
+}
 
-	return int(v)
+//Count 等待者的数量再加上锁持有者的数量 0 || 1
+func (m *Mutex) Count() int {
+	s := m.State()
+	if s.Locked {
+		return s.Waiters + 1
+	}
+	return s.Waiters
 }
 
 
@@ -84,6 +145,7 @@ func (m *Mutex) Count() int {
 
 type SliceQueue struct {
 	data []interface{}
+	head int //队头在data中的下标，出队只移动head，避免 q.data = q.data[1:] 让底层数组一直无法回收
 	mu sync.Mutex
 }
 
@@ -100,14 +162,39 @@ func (q *SliceQueue) Enqueue(v interface{}) {
 
 func (q *SliceQueue) Dequeue() interface{} {
 	q.mu.Lock()
-	if len(q.data) == 0 {
+	if q.head == len(q.data) {
 		q.mu.Unlock()
 		return nil
 	}
 
-	v := q.data[0]
-	q.data = q.data[1:]
+	v := q.data[q.head]
+	q.data[q.head] = nil //不再引用出队的元素
+	q.head++
+	q.compact()
 
 	q.mu.Unlock()
 	return v
-}
\ No newline at end of file
+}
+
+//Len 队列中元素的数量
+func (q *SliceQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.data) - q.head
+}
+
+//compact 已出队的部分超过一半时把剩余元素移到数组开头，均摊下来每次出队还是O(1)
+func (q *SliceQueue) compact() {
+	if q.head == len(q.data) {
+		q.data, q.head = q.data[:0], 0
+		return
+	}
+	if q.head < len(q.data)/2 {
+		return
+	}
+	n := copy(q.data, q.data[q.head:])
+	for i := n; i < len(q.data); i++ {
+		q.data[i] = nil
+	}
+	q.data, q.head = q.data[:n], 0
+}
@@ -0,0 +1,443 @@
+package stress
+
+import (
+	"fmt"
+	lfatomic "go-learn.com/v1/biz/atomic"
+	_map "go-learn.com/v1/biz/map"
+	"go-learn.com/v1/biz/race"
+	"go-learn.com/v1/biz/readersWriters"
+	"go-learn.com/v1/biz/waitGroup"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//Scenarios 仓库中所有 Counter、队列、栈、map 和缓存类型的压测场景，新加的并发容器也要在这里加上
+func Scenarios() []Scenario {
+	return []Scenario{
+		CounterScenario("race.Counter", func() Counter { return &race.Counter{} }),
+		CounterScenario("waitGroup.Counter", func() Counter { return &waitGroup.Counter{} }),
+		CounterScenario("readersWriters.Counter", func() Counter { return &readersWriters.Counter{} }),
+		QueueScenario("race.SliceQueue", func(Config) Queue { return sliceQueue{race.NewSliceQueue(16)} }),
+		QueueScenario("race.BlockingQueue", func(Config) Queue { return blockingQueue{race.NewBlockingQueue(64)} }),
+		QueueScenario("atomic.LKQueue", func(Config) Queue { return lkQueue{lfatomic.NewLKQueue()} }),
+		StackScenario("atomic.LKStack", func() Stack { return lfatomic.NewLKStack() }),
+		MapScenario("map.RWMap", func() Map { return rwMap{_map.NewRWMap(0)} }),
+		MapScenario("map.ConcurrentMap", func() Map { return concurrentMap{_map.New()} }),
+		MapScenario("map.COWMap", func() Map { return cowMap{_map.NewCOWMap(nil)} }),
+		MapScenario("map.KeyedMap", func() Map { return keyedMap{_map.NewKeyedMap()} }),
+		//元素设置了过期时间但不会过期，清理 goroutine 和读写并发地扫描分片
+		MapScenario("map.TTLMap", func() Map {
+			return ttlMap{_map.NewTTLMap(_map.TTLOptions{DefaultTTL: time.Hour, CleanupInterval: time.Millisecond})}
+		}),
+		CacheScenario("map.Cache(LRU)", _map.LRU),
+		CacheScenario("map.Cache(LFU)", _map.LFU),
+	}
+}
+
+//Counter race、waitGroup、readersWriters 中的计数器
+type Counter interface {
+	Incr()
+	Count() uint64
+}
+
+//CounterScenario 并发计数：自己 Incr 之后读到的值一定比之前大，最终的计数等于操作次数
+func CounterScenario(name string, newCounter func() Counter) Scenario {
+	var c Counter
+	return Scenario{
+		Name:  name,
+		Setup: func(Config) { c = newCounter() },
+		Op: func(w *Worker) error {
+			before := c.Count()
+			w.Yield()
+			c.Incr()
+			if after := c.Count(); after <= before {
+				return fmt.Errorf("count went from %d to %d after Incr", before, after)
+			}
+			return nil
+		},
+		Check: func(r *Result) error {
+			if got := c.Count(); got != uint64(r.Ops) {
+				return fmt.Errorf("count = %d, want %d", got, r.Ops)
+			}
+			return nil
+		},
+	}
+}
+
+//Queue 被测的队列，Enqueue 返回false表示队列满了，Dequeue 返回false表示队列是空的
+type Queue interface {
+	Enqueue(v interface{}) bool
+	Dequeue() (interface{}, bool)
+}
+
+//item 队列中的元素：生产者编号和它的序号
+type item struct {
+	producer int
+	seq      int
+}
+
+//QueueScenario 每个 goroutine 随机入队或者出队：
+//同一个消费者看到的同一个生产者的元素序号必须递增（FIFO），最终每个元素恰好出队一次
+func QueueScenario(name string, newQueue func(cfg Config) Queue) Scenario {
+	var (
+		q        Queue
+		next     []int   //每个生产者下一个序号，只由生产者自己修改
+		lastSeen [][]int //lastSeen[消费者][生产者] 看到的最大序号，只由消费者自己修改
+		received []int64 //每个生产者被取出的元素个数
+	)
+	//dequeue 出队一个元素并检查顺序，队列为空时返回false
+	dequeue := func(consumer []int) (bool, error) {
+		v, ok := q.Dequeue()
+		if !ok {
+			return false, nil
+		}
+		it, ok := v.(item)
+		if !ok {
+			return true, fmt.Errorf("dequeued %#v, not an item", v)
+		}
+		if it.producer < 0 || it.producer >= len(next) {
+			return true, fmt.Errorf("dequeued %+v from an unknown producer", it)
+		}
+		if it.seq <= consumer[it.producer] {
+			return true, fmt.Errorf("FIFO violated: producer %d seq %d after %d", it.producer, it.seq, consumer[it.producer])
+		}
+		consumer[it.producer] = it.seq
+		atomic.AddInt64(&received[it.producer], 1)
+		return true, nil
+	}
+
+	return Scenario{
+		Name: name,
+		Setup: func(cfg Config) {
+			q = newQueue(cfg)
+			next = make([]int, cfg.Goroutines)
+			received = make([]int64, cfg.Goroutines)
+			lastSeen = make([][]int, cfg.Goroutines+1) //最后一个给 Check 中的排空使用
+			for i := range lastSeen {
+				lastSeen[i] = make([]int, cfg.Goroutines)
+				for j := range lastSeen[i] {
+					lastSeen[i][j] = -1
+				}
+			}
+		},
+		Op: func(w *Worker) error {
+			if w.Rand.Intn(2) == 0 {
+				if q.Enqueue(item{producer: w.ID, seq: next[w.ID]}) {
+					next[w.ID]++
+				}
+				return nil
+			}
+			_, err := dequeue(lastSeen[w.ID])
+			return err
+		},
+		Check: func(r *Result) error {
+			//取出剩下的元素，同样检查顺序
+			drain := lastSeen[len(lastSeen)-1]
+			for {
+				ok, err := dequeue(drain)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					break
+				}
+			}
+			for p, n := range next {
+				if got := atomic.LoadInt64(&received[p]); got != int64(n) {
+					return fmt.Errorf("producer %d: enqueued %d, dequeued %d", p, n, got)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+//Stack 被测的栈，Pop 返回false表示栈是空的
+type Stack interface {
+	Push(v interface{})
+	Pop() (interface{}, bool)
+}
+
+//StackScenario 每个 goroutine 随机入栈或者出栈：每个元素最多出栈一次，最终取完之后每个元素恰好出栈一次
+func StackScenario(name string, newStack func() Stack) Scenario {
+	var (
+		st     Stack
+		next   []int    //每个 goroutine 下一个序号，只由自己修改
+		popped sync.Map //出栈过的 item
+		count  int64
+	)
+	pop := func() (bool, error) {
+		v, ok := st.Pop()
+		if !ok {
+			return false, nil
+		}
+		it, ok := v.(item)
+		if !ok {
+			return true, fmt.Errorf("popped %#v, not an item", v)
+		}
+		if _, dup := popped.LoadOrStore(it, true); dup {
+			return true, fmt.Errorf("%+v popped twice", it)
+		}
+		atomic.AddInt64(&count, 1)
+		return true, nil
+	}
+
+	return Scenario{
+		Name: name,
+		Setup: func(cfg Config) {
+			st = newStack()
+			next = make([]int, cfg.Goroutines)
+			popped = sync.Map{}
+			count = 0
+		},
+		Op: func(w *Worker) error {
+			if w.Rand.Intn(2) == 0 {
+				st.Push(item{producer: w.ID, seq: next[w.ID]})
+				next[w.ID]++
+				return nil
+			}
+			_, err := pop()
+			return err
+		},
+		Check: func(r *Result) error {
+			for {
+				ok, err := pop()
+				if err != nil {
+					return err
+				}
+				if !ok {
+					break
+				}
+			}
+			pushed := 0
+			for _, n := range next {
+				pushed += n
+			}
+			if int64(pushed) != count {
+				return fmt.Errorf("pushed %d, popped %d", pushed, count)
+			}
+			return nil
+		},
+	}
+}
+
+//Map 被测的 map，按 int 键计数，如果实现了 Len() int 也会检查键的数量，实现了 Close() 的在检查之后关闭
+type Map interface {
+	Get(k int) (int, bool)
+	Set(k, v int)
+}
+
+//每个 goroutine 负责的键的数量
+const keysPerWorker = 16
+
+//MapScenario 每个 goroutine 只修改自己的键（读-改-写加一），也会读取其他 goroutine 的键；
+//最终每个键的值等于它被修改的次数
+func MapScenario(name string, newMap func() Map) Scenario {
+	var (
+		m      Map
+		counts [][]int //counts[worker][k] 修改次数，只由 worker 自己修改
+	)
+	return Scenario{
+		Name: name,
+		Setup: func(cfg Config) {
+			m = newMap()
+			counts = make([][]int, cfg.Goroutines)
+			for i := range counts {
+				counts[i] = make([]int, keysPerWorker)
+			}
+		},
+		Op: func(w *Worker) error {
+			if w.Rand.Intn(4) == 0 {
+				//读取别人的键，值不能是负数
+				other := w.Rand.Intn(len(counts))
+				if v, ok := m.Get(other*keysPerWorker + w.Rand.Intn(keysPerWorker)); ok && v <= 0 {
+					return fmt.Errorf("read value %d", v)
+				}
+				return nil
+			}
+
+			k := w.Rand.Intn(keysPerWorker)
+			key := w.ID*keysPerWorker + k
+			v, _ := m.Get(key)
+			if v != counts[w.ID][k] {
+				return fmt.Errorf("key %d = %d, want %d", key, v, counts[w.ID][k])
+			}
+			w.Yield()
+			m.Set(key, v+1)
+			counts[w.ID][k]++
+			return nil
+		},
+		Check: func(r *Result) error {
+			if c, ok := m.(interface{ Close() }); ok {
+				defer c.Close()
+			}
+			keys := 0
+			for id, ks := range counts {
+				for k, want := range ks {
+					if want == 0 {
+						continue
+					}
+					keys++
+					if got, _ := m.Get(id*keysPerWorker + k); got != want {
+						return fmt.Errorf("key %d = %d, want %d", id*keysPerWorker+k, got, want)
+					}
+				}
+			}
+			if l, ok := m.(interface{ Len() int }); ok {
+				if n := l.Len(); n != keys {
+					return fmt.Errorf("Len = %d, want %d", n, keys)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+//cacheCapacity、cacheKeys 缓存场景的容量和键的范围，键比容量多得多，写入会不停地淘汰
+const (
+	cacheCapacity = 64
+	cacheKeys     = 1024
+)
+
+//CacheScenario 每个 goroutine 随机读写 cacheKeys 个键，键 k 的值总是 k：
+//读到的值必须等于键，元素个数、权重不超过容量，命中加未命中等于读的次数，淘汰的计数等于 OnEvict 的调用次数
+func CacheScenario(name string, policy _map.EvictionPolicy) Scenario {
+	var (
+		c       *_map.Cache
+		gets    []uint64 //每个 goroutine 读的次数，只由自己修改
+		evicted int64
+	)
+	return Scenario{
+		Name: name,
+		Setup: func(cfg Config) {
+			evicted = 0
+			c = _map.NewCache(_map.CacheOptions{
+				Policy:   policy,
+				Capacity: cacheCapacity,
+				OnEvict:  func(string, interface{}) { atomic.AddInt64(&evicted, 1) },
+			}, _map.WithShardCount(4))
+			gets = make([]uint64, cfg.Goroutines)
+		},
+		Op: func(w *Worker) error {
+			k := w.Rand.Intn(cacheKeys)
+			key := strconv.Itoa(k)
+			if w.Rand.Intn(2) == 0 {
+				if !c.Set(key, k) {
+					return fmt.Errorf("Set(%s) rejected", key)
+				}
+				return nil
+			}
+			gets[w.ID]++
+			if v, ok := c.Get(key); ok && v != k {
+				return fmt.Errorf("Get(%s) = %v", key, v)
+			}
+			return nil
+		},
+		Check: func(r *Result) error {
+			st := c.Stats()
+			if st.Len > cacheCapacity || st.Weight != int64(st.Len) {
+				return fmt.Errorf("Len = %d, Weight = %d, capacity %d", st.Len, st.Weight, cacheCapacity)
+			}
+			var total uint64
+			for _, n := range gets {
+				total += n
+			}
+			if st.Hits+st.Misses != total {
+				return fmt.Errorf("hits %d + misses %d, want %d gets", st.Hits, st.Misses, total)
+			}
+			if n := atomic.LoadInt64(&evicted); st.Evictions != uint64(n) {
+				return fmt.Errorf("Evictions = %d, OnEvict called %d times", st.Evictions, n)
+			}
+			return nil
+		},
+	}
+}
+
+//下面是各个类型到 Queue、Map 的适配
+
+type sliceQueue struct{ q *race.SliceQueue }
+
+func (q sliceQueue) Enqueue(v interface{}) bool { q.q.Enqueue(v); return true }
+func (q sliceQueue) Dequeue() (interface{}, bool) {
+	v := q.q.Dequeue()
+	return v, v != nil
+}
+
+type blockingQueue struct{ q *race.BlockingQueue }
+
+func (q blockingQueue) Enqueue(v interface{}) bool { return q.q.TryPut(v) == nil }
+func (q blockingQueue) Dequeue() (interface{}, bool) {
+	v, err := q.q.TryTake()
+	return v, err == nil
+}
+
+type lkQueue struct{ q *lfatomic.LKQueue }
+
+func (q lkQueue) Enqueue(v interface{}) bool { q.q.Enqueue(v); return true }
+func (q lkQueue) Dequeue() (interface{}, bool) {
+	v := q.q.Dequeue()
+	return v, v != nil
+}
+
+type rwMap struct{ m *_map.RWMap }
+
+func (m rwMap) Get(k int) (int, bool) {
+	v, ok := m.m.Get(k)
+	if !ok {
+		return 0, false
+	}
+	return v.(int), true
+}
+func (m rwMap) Set(k, v int) { m.m.Set(k, v) }
+func (m rwMap) Len() int     { return m.m.Len() }
+
+type concurrentMap struct{ m _map.ConcurrentMap }
+
+func (m concurrentMap) Get(k int) (int, bool) {
+	v, ok := m.m.Get(strconv.Itoa(k))
+	if !ok {
+		return 0, false
+	}
+	return v.(int), true
+}
+func (m concurrentMap) Set(k, v int) { m.m.Set(strconv.Itoa(k), v) }
+func (m concurrentMap) Len() int     { return m.m.Count() }
+
+type cowMap struct{ m *_map.COWMap }
+
+func (m cowMap) Get(k int) (int, bool) {
+	v, ok := m.m.Get(strconv.Itoa(k))
+	if !ok {
+		return 0, false
+	}
+	return v.(int), true
+}
+func (m cowMap) Set(k, v int) { m.m.Set(strconv.Itoa(k), v) }
+func (m cowMap) Len() int     { return m.m.Len() }
+
+type keyedMap struct{ m *_map.KeyedMap }
+
+func (m keyedMap) Get(k int) (int, bool) {
+	v, ok := m.m.Get(k)
+	if !ok {
+		return 0, false
+	}
+	return v.(int), true
+}
+func (m keyedMap) Set(k, v int) { m.m.Set(k, v) }
+func (m keyedMap) Len() int     { return m.m.Count() }
+
+type ttlMap struct{ m *_map.TTLMap }
+
+func (m ttlMap) Get(k int) (int, bool) {
+	v, ok := m.m.Get(strconv.Itoa(k))
+	if !ok {
+		return 0, false
+	}
+	return v.(int), true
+}
+func (m ttlMap) Set(k, v int) { m.m.Set(strconv.Itoa(k), v) }
+func (m ttlMap) Len() int     { return m.m.Count() }
+func (m ttlMap) Close()       { m.m.Close() }
@@ -0,0 +1,184 @@
+package stress
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/**
+ @desc 并发压测工具：N 个 goroutine 按时长或者次数执行场景，随机让出 CPU，最后检查不变量
+ @date 2026-10-18
+*/
+
+//race_test.go 里的 TestRace 只是打印一个数字，什么都没有检查。
+//这里把"启动 N 个 goroutine 反复操作，然后检查结果"抽出来：
+//每次操作可以返回 error 表示发现了违反不变量的情况，全部结束后再由 Check 检查最终状态（比如计数、FIFO 顺序）。
+
+//Config 压测的配置
+type Config struct {
+	//Goroutines 并发的 goroutine 数量，默认 2*GOMAXPROCS
+	Goroutines int
+	//Duration 每个 goroutine 运行的时间，为 0 时按 Ops 执行
+	Duration time.Duration
+	//Ops 每个 goroutine 执行的次数，Duration 和 Ops 都为 0 时默认 1000 次
+	Ops int
+	//YieldProb 每次操作之后调用 runtime.Gosched 的概率，用来打乱调度
+	YieldProb float64
+	//Seed 随机数种子，为 0 时使用当前时间
+	Seed int64
+}
+
+func (c Config) withDefaults() Config {
+	if c.Goroutines <= 0 {
+		c.Goroutines = 2 * runtime.GOMAXPROCS(0)
+	}
+	if c.Duration <= 0 && c.Ops <= 0 {
+		c.Ops = 1000
+	}
+	if c.Seed == 0 {
+		c.Seed = time.Now().UnixNano()
+	}
+	return c
+}
+
+//Scenario 压测场景
+type Scenario struct {
+	Name string
+	//Setup 在启动 goroutine 之前调用，可以用来创建被测对象
+	Setup func(cfg Config)
+	//Op 执行一次操作，返回的 error 会记为一次违反
+	Op func(w *Worker) error
+	//Check 所有 goroutine 结束后检查最终状态
+	Check func(r *Result) error
+}
+
+//Worker 执行操作的 goroutine
+type Worker struct {
+	//ID 从 0 开始的编号
+	ID int
+	//Rand 每个 goroutine 独立的随机数，不需要加锁
+	Rand *rand.Rand
+	//Ops 已经完成的操作次数（不包括当前这次）
+	Ops int
+
+	yieldProb float64
+}
+
+//Yield 按配置的概率让出 CPU，场景可以在操作的中间调用，增加交错的可能
+func (w *Worker) Yield() {
+	if w.yieldProb > 0 && w.Rand.Float64() < w.yieldProb {
+		runtime.Gosched()
+	}
+}
+
+//最多保留的违反信息条数
+const maxViolations = 20
+
+//Result 压测结果
+type Result struct {
+	Name       string
+	Config     Config
+	Ops        int64
+	PerWorker  []int
+	Elapsed    time.Duration
+	Violations int64
+	//Messages 前 maxViolations 条违反信息
+	Messages []string
+
+	mu sync.Mutex
+}
+
+//Violatef 记录一次违反
+func (r *Result) Violatef(format string, args ...interface{}) {
+	atomic.AddInt64(&r.Violations, 1)
+	r.mu.Lock()
+	if len(r.Messages) < maxViolations {
+		r.Messages = append(r.Messages, fmt.Sprintf(format, args...))
+	}
+	r.mu.Unlock()
+}
+
+//Throughput 每秒的操作次数
+func (r *Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Ops) / r.Elapsed.Seconds()
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("%s: %d goroutines, %d ops in %v (%.0f ops/s), %d violations, seed %d",
+		r.Name, r.Config.Goroutines, r.Ops, r.Elapsed.Round(time.Microsecond), r.Throughput(), r.Violations, r.Config.Seed)
+}
+
+//Run 执行场景
+func Run(cfg Config, s Scenario) *Result {
+	cfg = cfg.withDefaults()
+	r := &Result{Name: s.Name, Config: cfg, PerWorker: make([]int, cfg.Goroutines)}
+	if s.Setup != nil {
+		s.Setup(cfg)
+	}
+
+	var wg sync.WaitGroup
+	var deadline time.Time //按时长执行时的结束时间，在 start 关闭之前设置
+	start := make(chan struct{})
+	for i := 0; i < cfg.Goroutines; i++ {
+		wg.Add(1)
+		w := &Worker{ID: i, Rand: rand.New(rand.NewSource(cfg.Seed + int64(i))), yieldProb: cfg.YieldProb}
+		go func() {
+			defer wg.Done()
+			<-start
+			for ; ; w.Ops++ {
+				if deadline.IsZero() {
+					if w.Ops >= cfg.Ops {
+						break
+					}
+				} else if w.Ops%64 == 0 && time.Now().After(deadline) {
+					break
+				}
+				if err := s.Op(w); err != nil {
+					r.Violatef("worker %d op %d: %v", w.ID, w.Ops, err)
+				}
+				w.Yield()
+			}
+			r.PerWorker[w.ID] = w.Ops
+		}()
+	}
+
+	begin := time.Now()
+	if cfg.Duration > 0 {
+		deadline = begin.Add(cfg.Duration)
+	}
+	close(start)
+	wg.Wait()
+	r.Elapsed = time.Since(begin)
+	for _, n := range r.PerWorker {
+		r.Ops += int64(n)
+	}
+
+	if s.Check != nil {
+		if err := s.Check(r); err != nil {
+			r.Violatef("check: %v", err)
+		}
+	}
+	return r
+}
+
+//RunT 在测试中执行场景，输出吞吐量，每条违反信息都记为测试失败
+func RunT(t testing.TB, cfg Config, s Scenario) *Result {
+	t.Helper()
+	r := Run(cfg, s)
+	t.Log(r)
+	for _, msg := range r.Messages {
+		t.Errorf("%s: %s", r.Name, msg)
+	}
+	if n := r.Violations - int64(len(r.Messages)); n > 0 {
+		t.Errorf("%s: %d more violations", r.Name, n)
+	}
+	return r
+}
@@ -0,0 +1,57 @@
+package stress_test
+
+import (
+	"errors"
+	"go-learn.com/v1/biz/stress"
+	"testing"
+	"time"
+)
+
+//TestScenarios 仓库中所有 Counter、队列和 map 的压测
+func TestScenarios(t *testing.T) {
+	cfg := stress.Config{Goroutines: 8, Ops: 2000, YieldProb: 0.1}
+	if testing.Short() {
+		cfg.Ops = 200
+	}
+	for _, s := range stress.Scenarios() {
+		s := s
+		t.Run(s.Name, func(t *testing.T) {
+			stress.RunT(t, cfg, s)
+		})
+	}
+}
+
+//TestDuration 按时长运行
+func TestDuration(t *testing.T) {
+	s := stress.Scenarios()[0]
+	r := stress.RunT(t, stress.Config{Goroutines: 4, Duration: 20 * time.Millisecond}, s)
+	if r.Ops == 0 || r.Elapsed < 20*time.Millisecond {
+		t.Fatalf("ran %d ops in %v", r.Ops, r.Elapsed)
+	}
+}
+
+//TestViolations 场景发现的问题会被记录
+func TestViolations(t *testing.T) {
+	n := 0
+	r := stress.Run(stress.Config{Goroutines: 1, Ops: 100}, stress.Scenario{
+		Name: "broken",
+		Op: func(w *stress.Worker) error {
+			n++
+			if w.Ops%10 == 0 {
+				return errBroken
+			}
+			return nil
+		},
+		Check: func(r *stress.Result) error {
+			if n != 100 {
+				t.Errorf("Op ran %d times, want 100", n)
+			}
+			return errBroken
+		},
+	})
+	if r.Violations != 11 || len(r.Messages) != 11 || r.Ops != 100 {
+		t.Fatalf("result = %v, messages %q", r, r.Messages)
+	}
+}
+
+var errBroken = errors.New("broken")
@@ -0,0 +1,136 @@
+package lockcheck
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+//sync 包中使用后不能复制的类型
+var noCopyTypes = map[string]bool{
+	"Mutex":     true,
+	"RWMutex":   true,
+	"Once":      true,
+	"WaitGroup": true,
+	"Cond":      true,
+}
+
+//lockPath 如果 t 以值的方式包含锁，返回锁的类型名，否则返回空字符串
+func lockPath(t types.Type, seen map[types.Type]bool) string {
+	if seen[t] {
+		return ""
+	}
+	seen[t] = true
+
+	if named, ok := t.(*types.Named); ok {
+		obj := named.Obj()
+		if obj.Pkg() != nil && obj.Pkg().Path() == "sync" && noCopyTypes[obj.Name()] {
+			return "sync." + obj.Name()
+		}
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if p := lockPath(u.Field(i).Type(), seen); p != "" {
+				return p
+			}
+		}
+	case *types.Array:
+		return lockPath(u.Elem(), seen)
+	}
+	return ""
+}
+
+func containsLock(t types.Type) string {
+	return lockPath(t, make(map[types.Type]bool))
+}
+
+//checkCopyParams 参数和接收者以值的方式传递锁
+func (c *checker) checkCopyParams(recv *ast.FieldList, ft *ast.FuncType) {
+	check := func(fields *ast.FieldList, what string) {
+		if fields == nil {
+			return
+		}
+		for _, field := range fields.List {
+			t := c.pass.TypesInfo.TypeOf(field.Type)
+			if t == nil {
+				continue
+			}
+			if p := containsLock(t); p != "" {
+				c.reportf(field.Type.Pos(), "%s passes lock by value: %s contains %s", what, types.ExprString(field.Type), p)
+			}
+		}
+	}
+	check(recv, "receiver")
+	check(ft.Params, "parameter")
+}
+
+//checkCopyArgs 调用时以值的方式传递锁，比如 copyFoo(c)
+func (c *checker) checkCopyArgs(call *ast.CallExpr) {
+	if _, ok := typeutil.Callee(c.pass.TypesInfo, call).(*types.Builtin); ok {
+		return
+	}
+	if tv, ok := c.pass.TypesInfo.Types[call.Fun]; ok && tv.IsType() {
+		return //类型转换
+	}
+	for _, arg := range call.Args {
+		switch unparen(arg).(type) {
+		case *ast.CompositeLit, *ast.CallExpr:
+			//新创建的值，没有复制使用过的锁
+			continue
+		}
+		t := c.pass.TypesInfo.TypeOf(arg)
+		if t == nil {
+			continue
+		}
+		if p := containsLock(t); p != "" {
+			c.reportf(arg.Pos(), "call of %s copies lock value: %s contains %s", types.ExprString(call.Fun), types.ExprString(arg), p)
+		}
+	}
+}
+
+//checkOnceDo once.Do 的函数中再次调用同一个 once 的 Do 会死锁
+func (c *checker) checkOnceDo(call *ast.CallExpr) {
+	recv, ok := onceDo(c.pass.TypesInfo, call)
+	if !ok || len(call.Args) != 1 {
+		return
+	}
+	lit, ok := unparen(call.Args[0]).(*ast.FuncLit)
+	if !ok {
+		return
+	}
+	key, obj := lockKey(recv), rootObj(c.pass.TypesInfo, recv)
+	ast.Inspect(lit.Body, func(n ast.Node) bool {
+		inner, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if r, ok := onceDo(c.pass.TypesInfo, inner); ok && lockKey(r) == key && rootObj(c.pass.TypesInfo, r) == obj {
+			c.reportf(inner.Pos(), "%s.Do called inside the function passed to %s.Do deadlocks", key, key)
+		}
+		return true
+	})
+}
+
+//onceDo 判断 call 是不是 sync.Once 的 Do 方法
+func onceDo(info *types.Info, call *ast.CallExpr) (ast.Expr, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Do" {
+		return nil, false
+	}
+	fn, ok := info.Uses[sel.Sel].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != "sync" {
+		return nil, false
+	}
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return nil, false
+	}
+	if ptr, ok := recv.Type().(*types.Pointer); ok {
+		if named, ok := ptr.Elem().(*types.Named); ok && named.Obj().Name() == "Once" {
+			return sel.X, true
+		}
+	}
+	return nil, false
+}
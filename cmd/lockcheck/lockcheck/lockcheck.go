@@ -0,0 +1,491 @@
+package lockcheck
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+/**
+ @desc 静态检查 race_bug.go 等文件里记录的锁误用
+ @date 2026-10-18
+*/
+
+//检查的问题：
+//1、复制锁：以值的方式传递包含锁的结构体，比如 copyFoo(c counterBug)
+//2、Lock/Unlock 未成对：对本函数中声明、从未加锁的锁 defer Unlock，比如 foo()
+//3、重入：持有锁的时候再次加锁，或者调用一个会对同一个锁参数加锁的函数，比如 reentryFoo/reentryBar
+//4、持有锁的时候向 channel 发送数据，接收方如果也需要这把锁就会死锁
+//5、同一个 goroutine 递归获取读锁，比如 readersWriters.factorial，有 writer 等待时会死锁
+//6、在 once.Do 的函数中调用同一个 once 的 Do
+//检查是按语句顺序在函数内进行的，不做完整的控制流分析，分支里的加锁/解锁不会影响分支外面
+//确认没有问题的地方可以在同一行或者上一行加上 //lockcheck:ignore 注释
+
+const Doc = `check for sync.Mutex, sync.RWMutex and sync.Once misuse
+
+The lockcheck analyzer reports locks passed by value, deferred Unlock of a
+lock that was never locked, re-locking a held Mutex directly or through a
+call, channel sends while holding a lock, recursive RLock, and calling
+once.Do from inside the same Once's function.`
+
+//Analyzer 锁误用检查
+var Analyzer = &analysis.Analyzer{
+	Name:      "lockcheck",
+	Doc:       Doc,
+	Requires:  []*analysis.Analyzer{inspect.Analyzer},
+	Run:       run,
+	FactTypes: []analysis.Fact{new(paramLocksFact)},
+}
+
+//paramLocksFact 函数会对哪些参数加锁（参数下标 -> Lock/RLock），导出给依赖这个包的包使用，
+//这样跨包调用也能发现重入
+type paramLocksFact struct {
+	Params map[int]lockOp
+}
+
+func (*paramLocksFact) AFact() {}
+
+func (f *paramLocksFact) String() string {
+	idx := make([]int, 0, len(f.Params))
+	for i := range f.Params {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	parts := make([]string, len(idx))
+	for j, i := range idx {
+		parts[j] = fmt.Sprintf("%d:%s", i, methodName(f.Params[i]))
+	}
+	return "locks(" + strings.Join(parts, ",") + ")"
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	ins := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	c := &checker{pass: pass, summaries: summarize(pass, ins), ignored: ignoredLines(pass)}
+
+	ins.Preorder([]ast.Node{(*ast.FuncDecl)(nil), (*ast.FuncLit)(nil), (*ast.CallExpr)(nil)}, func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			c.checkCopyParams(n.Recv, n.Type)
+			if n.Body != nil {
+				c.checkFunc(n.Body)
+			}
+		case *ast.FuncLit:
+			c.checkCopyParams(nil, n.Type)
+			c.checkFunc(n.Body)
+		case *ast.CallExpr:
+			c.checkCopyArgs(n)
+			c.checkOnceDo(n)
+		}
+	})
+	return nil, nil
+}
+
+type checker struct {
+	pass *analysis.Pass
+	//本包中的函数会对哪些参数加锁
+	summaries map[*types.Func]map[int]lockOp
+	//带有 lockcheck:ignore 注释的行
+	ignored map[lineKey]bool
+}
+
+type lineKey struct {
+	file string
+	line int
+}
+
+//ignoredLines 找出 lockcheck:ignore 注释所在的行
+func ignoredLines(pass *analysis.Pass) map[lineKey]bool {
+	ignored := make(map[lineKey]bool)
+	for _, f := range pass.Files {
+		for _, group := range f.Comments {
+			for _, comment := range group.List {
+				if strings.Contains(comment.Text, "lockcheck:ignore") {
+					p := pass.Fset.Position(comment.Slash)
+					ignored[lineKey{p.Filename, p.Line}] = true
+				}
+			}
+		}
+	}
+	return ignored
+}
+
+//reportf 报告问题，同一行或者上一行有 lockcheck:ignore 注释时忽略
+func (c *checker) reportf(pos token.Pos, format string, args ...interface{}) {
+	p := c.pass.Fset.Position(pos)
+	if c.ignored[lineKey{p.Filename, p.Line}] || c.ignored[lineKey{p.Filename, p.Line - 1}] {
+		return
+	}
+	c.pass.Reportf(pos, format, args...)
+}
+
+//paramLocks 函数会对哪些参数加锁，其他包的函数从 fact 中获取
+func (c *checker) paramLocks(fn *types.Func) map[int]lockOp {
+	if m, ok := c.summaries[fn]; ok {
+		return m
+	}
+	var f paramLocksFact
+	if fn.Pkg() != c.pass.Pkg && c.pass.ImportObjectFact(fn, &f) {
+		return f.Params
+	}
+	return nil
+}
+
+//lockOp 锁上的操作
+type lockOp int
+
+const (
+	opNone lockOp = iota
+	opLock
+	opRLock
+	opUnlock
+	opRUnlock
+)
+
+var lockMethods = map[string]lockOp{
+	"Lock":    opLock,
+	"RLock":   opRLock,
+	"Unlock":  opUnlock,
+	"RUnlock": opRUnlock,
+}
+
+//lockCall 判断 call 是不是 x.Lock()/x.RLock()/x.Unlock()/x.RUnlock()，方法必须来自 sync 包，
+//包括 sync.Mutex、sync.RWMutex、sync.Locker 以及嵌入了它们的类型
+func lockCall(info *types.Info, call *ast.CallExpr) (ast.Expr, lockOp) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil, opNone
+	}
+	op, ok := lockMethods[sel.Sel.Name]
+	if !ok {
+		return nil, opNone
+	}
+	fn, ok := info.Uses[sel.Sel].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != "sync" {
+		return nil, opNone
+	}
+	return sel.X, op
+}
+
+//lockKey 锁的标识：表达式文本，去掉取地址和括号
+func lockKey(x ast.Expr) string {
+	return types.ExprString(unparen(x))
+}
+
+func unparen(x ast.Expr) ast.Expr {
+	for {
+		switch e := x.(type) {
+		case *ast.ParenExpr:
+			x = e.X
+		case *ast.UnaryExpr:
+			if e.Op != token.AND {
+				return x
+			}
+			x = e.X
+		case *ast.StarExpr:
+			x = e.X
+		default:
+			return x
+		}
+	}
+}
+
+//rootObj 表达式最左边的标识符对应的对象，比如 c.mu 中的 c
+func rootObj(info *types.Info, x ast.Expr) types.Object {
+	for {
+		switch e := unparen(x).(type) {
+		case *ast.Ident:
+			return info.Uses[e]
+		case *ast.SelectorExpr:
+			x = e.X
+		default:
+			return nil
+		}
+	}
+}
+
+//summarize 记录包内每个函数会对哪些参数加锁，用来发现 reentryFoo -> reentryBar 这样通过调用的重入
+func summarize(pass *analysis.Pass, ins *inspector.Inspector) map[*types.Func]map[int]lockOp {
+	summaries := make(map[*types.Func]map[int]lockOp)
+	ins.Preorder([]ast.Node{(*ast.FuncDecl)(nil)}, func(n ast.Node) {
+		decl := n.(*ast.FuncDecl)
+		fn, ok := pass.TypesInfo.Defs[decl.Name].(*types.Func)
+		if !ok || decl.Body == nil {
+			return
+		}
+		params := make(map[types.Object]int)
+		i := 0
+		for _, field := range decl.Type.Params.List {
+			if len(field.Names) == 0 {
+				i++
+				continue
+			}
+			for _, name := range field.Names {
+				params[pass.TypesInfo.Defs[name]] = i
+				i++
+			}
+		}
+
+		ast.Inspect(decl.Body, func(n ast.Node) bool {
+			if _, ok := n.(*ast.FuncLit); ok {
+				return false
+			}
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			x, op := lockCall(pass.TypesInfo, call)
+			if op != opLock && op != opRLock {
+				return true
+			}
+			if id, ok := unparen(x).(*ast.Ident); ok {
+				if idx, ok := params[pass.TypesInfo.Uses[id]]; ok {
+					if summaries[fn] == nil {
+						summaries[fn] = make(map[int]lockOp)
+					}
+					//同时有 Lock 和 RLock 时按 Lock 处理
+					if summaries[fn][idx] != opLock {
+						summaries[fn][idx] = op
+					}
+				}
+			}
+			return true
+		})
+		if m, ok := summaries[fn]; ok {
+			pass.ExportObjectFact(fn, &paramLocksFact{Params: m})
+		}
+	})
+	return summaries
+}
+
+//held 当前持有的锁
+type held struct {
+	op  lockOp
+	pos token.Pos
+}
+
+//funcState 一个函数的检查状态
+type funcState struct {
+	//曾经加过锁的锁，用来检查 defer Unlock 前没有 Lock
+	locked map[string]bool
+	body   *ast.BlockStmt
+}
+
+func (c *checker) checkFunc(body *ast.BlockStmt) {
+	fs := &funcState{locked: make(map[string]bool), body: body}
+	c.checkBlock(fs, body.List, make(map[string]held))
+}
+
+//checkBlock 按顺序检查语句，嵌套的语句块使用 held 的副本
+func (c *checker) checkBlock(fs *funcState, stmts []ast.Stmt, h map[string]held) {
+	for _, stmt := range stmts {
+		c.checkStmt(fs, stmt, h)
+	}
+}
+
+func copyHeld(h map[string]held) map[string]held {
+	m := make(map[string]held, len(h))
+	for k, v := range h {
+		m[k] = v
+	}
+	return m
+}
+
+func (c *checker) checkStmt(fs *funcState, stmt ast.Stmt, h map[string]held) {
+	info := c.pass.TypesInfo
+	switch s := stmt.(type) {
+	case *ast.ExprStmt:
+		if call, ok := s.X.(*ast.CallExpr); ok {
+			if x, op := lockCall(info, call); op != opNone {
+				c.lockOp(fs, h, x, op, call.Pos())
+				return
+			}
+		}
+	case *ast.DeferStmt:
+		if x, op := lockCall(info, s.Call); op == opUnlock || op == opRUnlock {
+			key := lockKey(x)
+			if !fs.locked[key] && c.localTo(fs, x) {
+				c.reportf(s.Pos(), "deferred %s of %s, which is never locked in this function", methodName(op), key)
+			}
+			//defer 的解锁在函数返回时才执行，之后的语句仍然持有锁
+			return
+		}
+		c.checkCalls(s.Call, h)
+		return
+	case *ast.GoStmt:
+		//新的 goroutine 不持有当前的锁
+		return
+	case *ast.SendStmt:
+		c.checkSend(s, h)
+	case *ast.BlockStmt:
+		c.checkBlock(fs, s.List, copyHeld(h))
+		return
+	case *ast.IfStmt:
+		if s.Init != nil {
+			c.checkStmt(fs, s.Init, h)
+		}
+		c.checkCalls(s.Cond, h)
+		c.checkBlock(fs, s.Body.List, copyHeld(h))
+		if s.Else != nil {
+			c.checkStmt(fs, s.Else, copyHeld(h))
+		}
+		return
+	case *ast.ForStmt:
+		if s.Init != nil {
+			c.checkStmt(fs, s.Init, h)
+		}
+		c.checkBlock(fs, s.Body.List, copyHeld(h))
+		return
+	case *ast.RangeStmt:
+		c.checkCalls(s.X, h)
+		c.checkBlock(fs, s.Body.List, copyHeld(h))
+		return
+	case *ast.SwitchStmt:
+		if s.Init != nil {
+			c.checkStmt(fs, s.Init, h)
+		}
+		if s.Tag != nil {
+			c.checkCalls(s.Tag, h)
+		}
+		for _, cc := range s.Body.List {
+			c.checkBlock(fs, cc.(*ast.CaseClause).Body, copyHeld(h))
+		}
+		return
+	case *ast.TypeSwitchStmt:
+		for _, cc := range s.Body.List {
+			c.checkBlock(fs, cc.(*ast.CaseClause).Body, copyHeld(h))
+		}
+		return
+	case *ast.SelectStmt:
+		hasDefault := false
+		for _, cc := range s.Body.List {
+			if cc.(*ast.CommClause).Comm == nil {
+				hasDefault = true
+			}
+		}
+		for _, cc := range s.Body.List {
+			clause := cc.(*ast.CommClause)
+			if send, ok := clause.Comm.(*ast.SendStmt); ok && !hasDefault {
+				c.checkSend(send, h)
+			}
+			c.checkBlock(fs, clause.Body, copyHeld(h))
+		}
+		return
+	case *ast.LabeledStmt:
+		c.checkStmt(fs, s.Stmt, h)
+		return
+	}
+	c.checkCalls(stmt, h)
+}
+
+//lockOp 处理一次显式的加锁/解锁
+func (c *checker) lockOp(fs *funcState, h map[string]held, x ast.Expr, op lockOp, pos token.Pos) {
+	key := lockKey(x)
+	switch op {
+	case opLock, opRLock:
+		if prev, ok := h[key]; ok {
+			c.reportRelock(pos, key, prev, op, "")
+		}
+		h[key] = held{op: op, pos: pos}
+		fs.locked[key] = true
+	case opUnlock, opRUnlock:
+		delete(h, key)
+	}
+}
+
+//reportRelock 持有 prev 的时候再次以 op 加锁
+func (c *checker) reportRelock(pos token.Pos, key string, prev held, op lockOp, via string) {
+	prevPos := c.pass.Fset.Position(prev.pos)
+	if prev.op == opRLock && op == opRLock {
+		c.reportf(pos, "recursive RLock of %s%s (first RLock at line %d) deadlocks if a writer is waiting", key, via, prevPos.Line)
+		return
+	}
+	c.reportf(pos, "%s of %s%s while it is already held (locked at line %d); sync mutexes are not reentrant", methodName(op), key, via, prevPos.Line)
+}
+
+//checkCalls 检查语句中的函数调用是否会对已经持有的锁参数再次加锁，不进入函数字面量
+func (c *checker) checkCalls(n ast.Node, h map[string]held) {
+	if len(h) == 0 || n == nil {
+		return
+	}
+	ast.Inspect(n, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		fn, ok := typeutil.Callee(c.pass.TypesInfo, call).(*types.Func)
+		if !ok {
+			return true
+		}
+		for i, op := range c.paramLocks(fn) {
+			if i >= len(call.Args) {
+				continue
+			}
+			//以值的方式传递的是锁的副本，不会重入（复制锁本身由 checkCopyArgs 报告）
+			if !sharesLock(c.pass.TypesInfo.TypeOf(call.Args[i])) {
+				continue
+			}
+			key := lockKey(call.Args[i])
+			if prev, ok := h[key]; ok {
+				c.reportRelock(call.Pos(), key, prev, op, " via call to "+fn.Name())
+			}
+		}
+		return true
+	})
+}
+
+//checkSend 持有多把锁时报告最后加的那一把，map 的遍历顺序是随机的，不能随便取一个，否则每次的报告都不一样
+func (c *checker) checkSend(s *ast.SendStmt, h map[string]held) {
+	var last string
+	for key, l := range h {
+		if last == "" || l.pos > h[last].pos || l.pos == h[last].pos && key > last {
+			last = key
+		}
+	}
+	if last != "" {
+		c.reportf(s.Arrow, "channel send while holding %s (locked at line %d)", last, c.pass.Fset.Position(h[last].pos).Line)
+	}
+}
+
+//localTo 锁是不是在当前函数中声明的局部变量
+func (c *checker) localTo(fs *funcState, x ast.Expr) bool {
+	obj := rootObj(c.pass.TypesInfo, x)
+	if obj == nil {
+		return false
+	}
+	if _, ok := obj.(*types.Var); !ok {
+		return false
+	}
+	return obj.Pos() >= fs.body.Pos() && obj.Pos() < fs.body.End()
+}
+
+//sharesLock 参数是不是和调用者共享同一个锁：指针或者接口（比如 sync.Locker）
+func sharesLock(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	switch t.Underlying().(type) {
+	case *types.Pointer, *types.Interface:
+		return true
+	}
+	return false
+}
+
+func methodName(op lockOp) string {
+	for name, o := range lockMethods {
+		if o == op {
+			return name
+		}
+	}
+	return ""
+}
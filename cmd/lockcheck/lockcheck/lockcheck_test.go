@@ -0,0 +1,13 @@
+package lockcheck_test
+
+import (
+	"go-learn.com/v1/cmd/lockcheck/lockcheck"
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+//TestAnalyzer testdata/src 中 // want 注释标出了期望的报告
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), lockcheck.Analyzer, "a", "b")
+}
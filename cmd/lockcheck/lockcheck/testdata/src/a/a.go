@@ -0,0 +1,130 @@
+package a
+
+import (
+	"fmt"
+	"sync"
+)
+
+//race_bug.go 中的例子
+
+func foo() {
+	var mu sync.Mutex
+	defer mu.Unlock() // want `deferred Unlock of mu, which is never locked in this function`
+	fmt.Println("hello, world!")
+}
+
+func fooOK() {
+	var mu sync.Mutex
+	mu.Lock()
+	defer mu.Unlock()
+}
+
+type counterBug struct {
+	sync.Mutex
+	countBug int
+}
+
+func CopyBug() {
+	var c counterBug
+	c.Lock()
+	defer c.Unlock()
+	c.countBug++
+	copyFoo(c) // want `call of copyFoo copies lock value: c contains sync.Mutex`
+}
+
+func copyFoo(c counterBug) { // want `parameter passes lock by value: counterBug contains sync.Mutex` copyFoo:`locks\(0:Lock\)`
+	c.Lock()
+	defer c.Unlock()
+}
+
+func (c counterBug) value() int { // want `receiver passes lock by value: counterBug contains sync.Mutex`
+	return c.countBug
+}
+
+func ReentryFoo(l sync.Locker) { // want ReentryFoo:`locks\(0:Lock\)`
+	l.Lock()
+	ReentryBar(l) // want `Lock of l via call to ReentryBar while it is already held`
+	l.Unlock()
+	ReentryBar(l)
+}
+
+func ReentryBar(l sync.Locker) { // want ReentryBar:`locks\(0:Lock\)`
+	l.Lock()
+	l.Unlock()
+}
+
+func directReentry(mu *sync.Mutex) { // want directReentry:`locks\(0:Lock\)`
+	mu.Lock()
+	mu.Lock() // want `Lock of mu while it is already held`
+	mu.Unlock()
+	mu.Unlock()
+}
+
+//持有锁的时候发送
+
+func sendWhileLocked(mu *sync.Mutex, ch chan int) { // want sendWhileLocked:`locks\(0:Lock\)`
+	mu.Lock()
+	ch <- 1 // want `channel send while holding mu`
+	mu.Unlock()
+	ch <- 2
+
+	mu.Lock()
+	defer mu.Unlock()
+	select {
+	case ch <- 3: // want `channel send while holding mu`
+	case <-ch:
+	}
+	select {
+	case ch <- 4:
+	default:
+	}
+	go func() {
+		ch <- 5
+	}()
+	ch <- 6 //lockcheck:ignore 调用者保证 ch 有缓冲
+}
+
+//持有两把锁时报告最后加的那一把
+
+func sendWhileLockedTwice(outer, inner *sync.Mutex, ch chan int) { // want sendWhileLockedTwice:`locks\(0:Lock,1:Lock\)`
+	outer.Lock()
+	inner.Lock()
+	ch <- 1 // want `channel send while holding inner \(locked at line 91\)`
+	inner.Unlock()
+	ch <- 2 // want `channel send while holding outer \(locked at line 90\)`
+	outer.Unlock()
+}
+
+//readersWriters.factorial
+
+func factorial(m *sync.RWMutex, n int) int { // want factorial:`locks\(0:RLock\)`
+	if n < 1 {
+		return 0
+	}
+	m.RLock()
+	defer m.RUnlock()
+	return factorial(m, n-1) * n // want `recursive RLock of m via call to factorial`
+}
+
+func rlockTwice(m *sync.RWMutex) { // want rlockTwice:`locks\(0:RLock\)`
+	m.RLock()
+	m.RLock() // want `recursive RLock of m`
+	m.RUnlock()
+	m.RUnlock()
+}
+
+//once.Do 嵌套
+
+func onceError() {
+	var once sync.Once
+	once.Do(func() {
+		once.Do(func() { // want `once.Do called inside the function passed to once.Do deadlocks`
+			fmt.Println("初始化")
+		})
+	})
+
+	var other sync.Once
+	once.Do(func() {
+		other.Do(func() {})
+	})
+}
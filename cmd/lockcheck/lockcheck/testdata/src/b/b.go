@@ -0,0 +1,13 @@
+package b
+
+import (
+	"a"
+	"sync"
+)
+
+//通过 fact 发现跨包的重入
+func crossPackage(mu *sync.Mutex) { // want crossPackage:`locks\(0:Lock\)`
+	mu.Lock()
+	defer mu.Unlock()
+	a.ReentryBar(mu) // want `Lock of mu via call to ReentryBar while it is already held`
+}
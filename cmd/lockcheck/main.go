@@ -0,0 +1,14 @@
+package main
+
+import (
+	"go-learn.com/v1/cmd/lockcheck/lockcheck"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+//lockcheck 检查锁的误用
+//它是一个单独的 module（依赖较新的 golang.org/x/tools），在仓库根目录下这样使用：
+//	go -C cmd/lockcheck build -o ../../lockcheck . && ./lockcheck ./...
+//或者交给 go vet：go vet -vettool=$(pwd)/lockcheck ./...
+func main() {
+	singlechecker.Main(lockcheck.Analyzer)
+}
@@ -1,5 +1,3 @@
 module go-learn.com/v1
 
 go 1.14
-
-require github.com/petermattis/goid v0.0.0-20180202154549-b0b1615b78e5 // indirect